@@ -0,0 +1,101 @@
+// accrual-sim — локальный симулятор системы расчёта начислений. Флаги -a и -d совпадают
+// с флагами бинарника системы расчёта из курса, поэтому симулятор можно запускать вместо него
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/accrual/accrualtest"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+func main() {
+	var (
+		address     string
+		rewardsFile string
+		scriptsFile string
+		opts        accrualtest.Options
+	)
+
+	// RUN_ADDRESS подставляется значением по умолчанию, поэтому явно заданный -a важнее переменной
+	defaultAddress := "localhost:8081"
+	if envAddress := os.Getenv("RUN_ADDRESS"); envAddress != "" {
+		defaultAddress = envAddress
+	}
+
+	flag.StringVar(&address, "a", defaultAddress, "address to listen on (RUN_ADDRESS)")
+	flag.String("d", "", "database URI, ignored; accepted for compatibility with the accrual binary")
+	flag.DurationVar(&opts.ProcessingDelay, "processing-delay", time.Second, "time an order spends in REGISTERED and then in PROCESSING")
+	flag.DurationVar(&opts.ResponseDelay, "response-delay", 0, "delay before every API response")
+	flag.IntVar(&opts.RateLimit, "rate-limit", 0, "order status requests per minute before 429, 0 disables the limit")
+	flag.DurationVar(&opts.RetryAfter, "retry-after", accrualtest.DefaultRetryAfter, "Retry-After of 429 responses")
+	flag.IntVar(&opts.FailEvery, "fail-every", 0, "answer every N-th API request with 500, 0 disables failures")
+	flag.StringVar(&rewardsFile, "rewards", "", "JSON file with reward rules loaded on start")
+	flag.StringVar(&scriptsFile, "scripts", "", "JSON file with response scripts by order number")
+	flag.Parse()
+
+	if err := logger.Initialize("info", logger.Sampling{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer logger.Log.Sync()
+
+	if err := readJSON(rewardsFile, &opts.Rewards); err != nil {
+		logger.Log.Fatal("Failed to read rewards", zap.Error(err))
+	}
+	if err := readJSON(scriptsFile, &opts.Scripts); err != nil {
+		logger.Log.Fatal("Failed to read scripts", zap.Error(err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: accrualtest.New(opts),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error("Accrual simulator shutdown failed", zap.Error(err))
+		}
+	}()
+
+	logger.Log.Info("Accrual simulator started", zap.String("address", address))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Log.Fatal("Accrual simulator failed", zap.Error(err))
+	}
+}
+
+// readJSON читает необязательный JSON-файл; пустой путь оставляет v без изменений
+func readJSON(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
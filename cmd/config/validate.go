@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.RunAddress == "" {
+		fail("run_address", "is required")
+	} else if _, _, err := net.SplitHostPort(c.RunAddress); err != nil {
+		fail("run_address", "expected host:port, got %q", c.RunAddress)
+	}
+
+	if c.DatabaseURI == "" {
+		fail("database_uri", "is required")
+	}
+
+	if c.AccrualSystemAddress == "" {
+		fail("accrual_system_address", "is required")
+	} else if u, err := url.Parse(c.AccrualSystemAddress); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("accrual_system_address", "expected an http(s) URL, got %q", c.AccrualSystemAddress)
+	}
+
+	if c.AccrualTimeout <= 0 {
+		fail("accrual_timeout", "must be positive")
+	}
+	if c.AccrualMaxIdleConns <= 0 {
+		fail("accrual_max_idle_conns", "must be positive")
+	}
+
+	if c.AccrualBreakerFailures <= 0 {
+		fail("accrual_breaker_failures", "must be positive")
+	}
+	if c.AccrualBreakerOpenTimeout <= 0 {
+		fail("accrual_breaker_open_timeout", "must be positive")
+	}
+	if c.AccrualBreakerHalfOpen <= 0 {
+		fail("accrual_breaker_half_open_requests", "must be positive")
+	}
+
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		fail("log_level", "unknown level %q", c.LogLevel)
+	}
+	if c.LogSamplingInitial < 0 {
+		fail("log_sampling_initial", "must not be negative")
+	}
+	if c.LogSamplingThereafter < 0 {
+		fail("log_sampling_thereafter", "must not be negative")
+	}
+
+	var deprecatedAt time.Time
+	if c.APIV1Deprecated != "" {
+		var err error
+		if deprecatedAt, err = time.Parse(time.DateOnly, c.APIV1Deprecated); err != nil {
+			fail("api_v1_deprecated", "expected YYYY-MM-DD, got %q", c.APIV1Deprecated)
+		}
+	}
+	if c.APIV1Sunset != "" {
+		sunset, err := time.Parse(time.DateOnly, c.APIV1Sunset)
+		if err != nil {
+			fail("api_v1_sunset", "expected YYYY-MM-DD, got %q", c.APIV1Sunset)
+		} else if c.APIV1Deprecated == "" {
+			fail("api_v1_sunset", "requires api_v1_deprecated")
+		} else if !deprecatedAt.IsZero() && sunset.Before(deprecatedAt) {
+			fail("api_v1_sunset", "must not be before api_v1_deprecated")
+		}
+	}
+
+	if c.AdminAddress != "" {
+		if _, _, err := net.SplitHostPort(c.AdminAddress); err != nil {
+			fail("admin_address", "expected host:port, got %q", c.AdminAddress)
+		}
+	}
+
+	switch c.TracesExporter {
+	case "none", "stdout", "otlp":
+	default:
+		fail("traces_exporter", "expected none, stdout or otlp, got %q", c.TracesExporter)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		fail("shutdown_timeout", "must be positive")
+	}
+	if c.ShutdownDrainDelay < 0 {
+		fail("shutdown_drain_delay", "must not be negative")
+	}
+	if c.RequestTimeout < 0 {
+		fail("request_timeout", "must not be negative")
+	}
+	for path, timeout := range c.RouteTimeouts {
+		if timeout < 0 {
+			fail("route_timeouts", "timeout for %s must not be negative", path)
+		}
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("tls_cert_file", "tls_cert_file and tls_key_file must be set together")
+	}
+	if c.AdminClientCAFile != "" && c.TLSCertFile == "" {
+		fail("admin_client_ca_file", "requires tls_cert_file and tls_key_file")
+	}
+	if (c.AccrualClientCertFile == "") != (c.AccrualClientKeyFile == "") {
+		fail("accrual_client_cert_file", "accrual_client_cert_file and accrual_client_key_file must be set together")
+	}
+
+	files := []struct {
+		key  string
+		path string
+	}{
+		{"tls_cert_file", c.TLSCertFile},
+		{"tls_key_file", c.TLSKeyFile},
+		{"admin_client_ca_file", c.AdminClientCAFile},
+		{"accrual_ca_file", c.AccrualCAFile},
+		{"accrual_client_cert_file", c.AccrualClientCertFile},
+		{"accrual_client_key_file", c.AccrualClientKeyFile},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			fail(file.key, "%v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
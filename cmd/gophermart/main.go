@@ -1,53 +1,343 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/sol1corejz/goferrrmart/cmd/config"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"github.com/sol1corejz/goferrrmart/internal/admin"
 	"github.com/sol1corejz/goferrrmart/internal/handlers"
+	"github.com/sol1corejz/goferrrmart/internal/health"
+	"github.com/sol1corejz/goferrrmart/internal/hub"
 	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/metrics"
 	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/openapi"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
 	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"github.com/sol1corejz/goferrrmart/internal/tlsconfig"
+	"github.com/sol1corejz/goferrrmart/internal/tracing"
 	"github.com/sol1corejz/goferrrmart/internal/workers"
 	"go.uber.org/zap"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	config.ParseFlags()
+	if err := config.ParseFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
 
-	if err := logger.Initialize(config.LogLevel); err != nil {
+	if config.PrintConfig {
+		if err := config.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	sampling := logger.Sampling{Initial: config.Current.LogSamplingInitial, Thereafter: config.Current.LogSamplingThereafter}
+	if err := logger.Initialize(config.Current.LogLevel, sampling); err != nil {
 		logger.Log.Fatal("Failed to initialize logger", zap.Error(err))
 	}
+	defer logger.Log.Sync()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go watchLogLevel(ctx)
+
+	shutdownTracing, err := tracing.Init(context.Background(), config.Current.TracesExporter)
+	if err != nil {
+		logger.Log.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+
+	serverTLS, adminTLS, err := setupTLS(ctx)
+	if err != nil {
+		logger.Log.Fatal("Failed to configure TLS", zap.Error(err))
+	}
+
+	if err := setupAccrual(ctx); err != nil {
+		logger.Log.Fatal("Failed to configure accrual client", zap.Error(err))
+	}
 
-	if err := storage.Init(); err != nil {
+	if err := storage.Init(ctx); err != nil {
 		logger.Log.Error("Failed to init storage", zap.Error(err))
 		return
 	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			logger.Log.Error("Failed to close storage", zap.Error(err))
+		}
+	}()
 
-	workers.InitLoyaltySystem()
+	if err := metrics.RegisterDB(storage.DB); err != nil {
+		logger.Log.Error("Failed to register database metrics", zap.Error(err))
+	}
 
-	if err := run(); err != nil {
-		logger.Log.Fatal("Failed to run server", zap.Error(err))
+	if config.Current.AdminAddress != "" {
+		go func() {
+			if err := admin.Serve(ctx, config.Current.AdminAddress, adminTLS); err != nil {
+				logger.Log.Error("Admin server stopped", zap.Error(err))
+			}
+		}()
 	}
+
+	go hub.Default.Run(ctx)
+	workers.InitLoyaltySystem(ctx)
+	workers.InitWebhookDispatcher(ctx)
+
+	if err := run(ctx, serverTLS); err != nil {
+		logger.Log.Error("Failed to run server", zap.Error(err))
+	}
+
+	// Воркеры останавливаются по той же отмене контекста, дожидаемся текущих итераций
+	stop()
+	waitCtx, cancel := context.WithTimeout(context.Background(), config.Current.ShutdownTimeout)
+	defer cancel()
+
+	if err := workers.Wait(waitCtx); err != nil {
+		logger.Log.Error("Workers did not stop in time", zap.Error(err))
+	}
+
+	logger.Log.Info("Server stopped")
 }
 
-func run() error {
-	app := fiber.New()
+// watchLogLevel по SIGHUP переключает уровень логирования между debug и заданным в -l
+func watchLogLevel(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			level := logger.ToggleDebug()
+			logger.Log.Warn("Log level changed by SIGHUP", zap.Stringer("level", level))
+		}
+	}
+}
+
+// setupAccrual настраивает клиент системы расчёта, в том числе CA-бандл и клиентский сертификат
+func setupAccrual(ctx context.Context) error {
+	opts := accrual.Options{
+		Timeout:      config.Current.AccrualTimeout,
+		MaxIdleConns: config.Current.AccrualMaxIdleConns,
+	}
+
+	if config.Current.AccrualCAFile != "" || config.Current.AccrualClientCertFile != "" {
+		var clientCert *tlsconfig.CertReloader
+		if config.Current.AccrualClientCertFile != "" {
+			reloader, err := tlsconfig.NewCertReloader(config.Current.AccrualClientCertFile, config.Current.AccrualClientKeyFile)
+			if err != nil {
+				return err
+			}
+			go reloader.Watch(ctx, tlsconfig.WatchInterval)
+			clientCert = reloader
+		}
+
+		tlsConfig, err := tlsconfig.Client(config.Current.AccrualCAFile, clientCert)
+		if err != nil {
+			return err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	accrual.Default = accrual.NewBreaker(accrual.New(config.Current.AccrualSystemAddress, opts), accrual.BreakerOptions{
+		Failures:         config.Current.AccrualBreakerFailures,
+		OpenTimeout:      config.Current.AccrualBreakerOpenTimeout,
+		HalfOpenRequests: config.Current.AccrualBreakerHalfOpen,
+	})
+	return nil
+}
+
+// setupTLS загружает сертификат сервера и запускает его перечитывание при изменении файлов.
+// Без tls_cert_file сервер и админка работают по HTTP
+func setupTLS(ctx context.Context) (*tls.Config, *tls.Config, error) {
+	if config.Current.TLSCertFile == "" {
+		return nil, nil, nil
+	}
+
+	reloader, err := tlsconfig.NewCertReloader(config.Current.TLSCertFile, config.Current.TLSKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	go reloader.Watch(ctx, tlsconfig.WatchInterval)
+
+	serverTLS, err := tlsconfig.Server(reloader, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	adminTLS, err := tlsconfig.Server(reloader, config.Current.AdminClientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return serverTLS, adminTLS, nil
+}
+
+// run обслуживает запросы до отмены ctx, после чего перестаёт принимать соединения
+// и дожидается завершения текущих запросов. С tlsConfig сервер работает по HTTPS
+func run(ctx context.Context, tlsConfig *tls.Config) error {
+	app, err := newApp()
+	if err != nil {
+		return err
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		logger.Log.Info("Running server", zap.String("address", config.Current.RunAddress), zap.Bool("tls", tlsConfig != nil))
+		if tlsConfig == nil {
+			listenErr <- app.Listen(config.Current.RunAddress)
+			return
+		}
+
+		ln, err := net.Listen("tcp", config.Current.RunAddress)
+		if err != nil {
+			listenErr <- err
+			return
+		}
+		listenErr <- app.Listener(tls.NewListener(ln, tlsConfig))
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Log.Info("Shutting down server",
+		zap.Duration("drainDelay", config.Current.ShutdownDrainDelay),
+		zap.Duration("timeout", config.Current.ShutdownTimeout),
+	)
+	// Пока балансировщик не увидел 503 от /readyz, он продолжает присылать запросы,
+	// поэтому сервер ещё какое-то время принимает соединения
+	health.SetDraining()
+	select {
+	case <-time.After(config.Current.ShutdownDrainDelay):
+	case err := <-listenErr:
+		return err
+	}
+	hub.Default.Close()
+
+	return app.ShutdownWithTimeout(config.Current.ShutdownTimeout)
+}
+
+// newApp собирает приложение со всеми middleware и маршрутами. Маршрут, которого нет
+// в спецификации OpenAPI, — ошибка: документация не должна отставать от API
+func newApp() (*fiber.App, error) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: problem.ErrorHandler,
+	})
+	app.Use(tracing.Middleware)
+	app.Use(middleware.RequestLogger)
+	app.Use(metrics.Middleware)
+	// Ошибки отрисовываются снаружи RequestContext, чтобы ответы о таймауте и остановке
+	// сервера попадали в метрики, логи и трейсы с итоговым статусом
+	app.Use(problem.Middleware)
+	app.Use(middleware.RequestContext(middleware.TimeoutConfig{
+		Default: config.Current.RequestTimeout,
+		Routes:  config.Current.RouteTimeouts,
+	}))
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,OPTIONS",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,DELETE,OPTIONS",
+		ExposeHeaders: middleware.HeaderRequestID,
 	}))
 
-	app.Post("/api/user/register", handlers.RegisterHandler)
-	app.Post("/api/user/login", handlers.LoginHandler)
+	app.Get("/healthz", health.LivenessHandler)
+	app.Get("/readyz", health.ReadinessHandler)
 
-	authRoutes := app.Group("/api/user", middleware.AuthMiddleware)
+	app.Get("/api/openapi.json", openapi.SpecHandler)
+	app.Get("/api/docs", openapi.DocsHandler)
+	app.Get("/api/docs/:file", openapi.AssetsHandler)
+
+	if err := registerV1(app); err != nil {
+		return nil, err
+	}
+	registerV2(app)
+
+	missing, err := openapi.MissingRoutes(app.GetRoutes(true))
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("routes missing from OpenAPI specification: %s", strings.Join(missing, ", "))
+	}
+
+	return app, nil
+}
+
+// registerV1 регистрирует исходное API /api/user, его поведение заморожено
+func registerV1(app *fiber.App) error {
+	deprecation := middleware.DeprecationConfig{
+		Prefix:          "/api/user",
+		SuccessorPrefix: "/api/v2/user",
+	}
+	if config.Current.APIV1Deprecated != "" {
+		deprecatedAt, err := time.Parse(time.DateOnly, config.Current.APIV1Deprecated)
+		if err != nil {
+			return fmt.Errorf("invalid API v1 deprecation date: %w", err)
+		}
+		deprecation.DeprecatedAt = deprecatedAt
+	}
+	if config.Current.APIV1Sunset != "" {
+		sunset, err := time.Parse(time.DateOnly, config.Current.APIV1Sunset)
+		if err != nil {
+			return fmt.Errorf("invalid API v1 sunset date: %w", err)
+		}
+		deprecation.Sunset = sunset
+	}
+
+	v1 := app.Group("/api/user", middleware.Deprecation(deprecation))
+	v1.Post("/register", handlers.RegisterHandler)
+	v1.Post("/login", handlers.LoginHandler)
+
+	authRoutes := v1.Group("", middleware.AuthMiddleware)
 	authRoutes.Get("/orders", handlers.GetOrdersHandler)
 	authRoutes.Post("/orders", handlers.CreateOrderHandler)
+	authRoutes.Get("/orders/stream", handlers.StreamOrdersHandler)
 	authRoutes.Get("/balance", handlers.GetUserBalanceHandler)
 	authRoutes.Post("/balance/withdraw", handlers.WithdrawHandler)
 	authRoutes.Get("/withdrawals", handlers.GetWithdrawalsHandler)
+	authRoutes.Get("/statement", handlers.GetStatementHandler)
+	authRoutes.Post("/webhooks", handlers.CreateWebhookHandler)
+	authRoutes.Get("/webhooks", handlers.GetWebhooksHandler)
+	authRoutes.Delete("/webhooks/:id", handlers.DeleteWebhookHandler)
+	authRoutes.Get("/webhooks/:id/deliveries", handlers.GetWebhookDeliveriesHandler)
 
-	logger.Log.Info("Running server", zap.String("address", config.RunAddress))
-	return app.Listen(config.RunAddress)
+	return nil
+}
+
+// registerV2 регистрирует API /api/v2/user: денежные суммы строками и пагинация списков
+func registerV2(app *fiber.App) {
+	v2 := app.Group("/api/v2/user")
+	v2.Post("/register", handlers.RegisterHandler)
+	v2.Post("/login", handlers.LoginHandler)
+
+	authRoutes := v2.Group("", middleware.AuthMiddleware)
+	authRoutes.Get("/orders", handlers.GetOrdersV2Handler)
+	authRoutes.Post("/orders", handlers.CreateOrderHandler)
+	authRoutes.Get("/orders/stream", handlers.StreamOrdersHandler)
+	authRoutes.Get("/orders/:number", handlers.GetOrderV2Handler)
+	authRoutes.Get("/balance", handlers.GetUserBalanceV2Handler)
+	authRoutes.Post("/balance/withdraw", handlers.WithdrawV2Handler)
+	authRoutes.Get("/withdrawals", handlers.GetWithdrawalsV2Handler)
+	authRoutes.Get("/statement", handlers.GetStatementHandler)
+	authRoutes.Post("/webhooks", handlers.CreateWebhookHandler)
+	authRoutes.Get("/webhooks", handlers.GetWebhooksHandler)
+	authRoutes.Delete("/webhooks/:id", handlers.DeleteWebhookHandler)
+	authRoutes.Get("/webhooks/:id/deliveries", handlers.GetWebhookDeliveriesHandler)
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/auth"
+	"github.com/sol1corejz/goferrrmart/internal/openapi"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRoutesDocumented падает, если маршрут зарегистрирован, но не описан в openapi.json
+func TestRoutesDocumented(t *testing.T) {
+	if _, err := newApp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestResponsesMatchSpec проверяет ответы, которые хендлеры отдают без базы данных,
+// на соответствие кодам и схемам из спецификации
+func TestResponsesMatchSpec(t *testing.T) {
+	ctx := context.Background()
+
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = doc.Validate(ctx); err != nil {
+		t.Fatalf("invalid OpenAPI specification: %v", err)
+	}
+	doc.Servers = nil
+
+	// Страница документации и её файлы проверяются только по коду и типу ответа
+	openapi3filter.RegisterBodyDecoder(fiber.MIMETextHTML, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/css", openapi3filter.FileBodyDecoder)
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := newApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := auth.GenerateToken(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		auth        bool
+		cookie      string
+		wantStatus  int
+	}{
+		{name: "liveness", method: http.MethodGet, target: "/healthz", wantStatus: http.StatusOK},
+		{name: "readiness without database", method: http.MethodGet, target: "/readyz", wantStatus: http.StatusServiceUnavailable},
+		{name: "specification", method: http.MethodGet, target: "/api/openapi.json", wantStatus: http.StatusOK},
+		{name: "docs page", method: http.MethodGet, target: "/api/docs", wantStatus: http.StatusOK},
+		{name: "docs asset", method: http.MethodGet, target: "/api/docs/swagger-ui.css", wantStatus: http.StatusOK},
+		{name: "missing docs asset", method: http.MethodGet, target: "/api/docs/missing.js", wantStatus: http.StatusNotFound},
+		{name: "v1 without token", method: http.MethodGet, target: "/api/user/orders", wantStatus: http.StatusUnauthorized},
+		{name: "v2 with invalid token", method: http.MethodGet, target: "/api/v2/user/balance", cookie: "invalid", wantStatus: http.StatusUnauthorized},
+		{
+			name: "register with invalid body", method: http.MethodPost, target: "/api/v2/user/register",
+			contentType: fiber.MIMEApplicationJSON, body: "{", wantStatus: http.StatusBadRequest,
+		},
+		{name: "orders page limit", method: http.MethodGet, target: "/api/v2/user/orders?limit=0", auth: true, wantStatus: http.StatusBadRequest},
+		{
+			name: "order with negative price", method: http.MethodPost, target: "/api/v2/user/orders", auth: true,
+			contentType: fiber.MIMEApplicationJSON, body: `{"number":"12345678903","goods":[{"description":"Bork","price":-1}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "order with invalid number", method: http.MethodPost, target: "/api/user/orders", auth: true,
+			contentType: fiber.MIMETextPlain, body: "12345678904", wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "withdraw negative sum", method: http.MethodPost, target: "/api/v2/user/balance/withdraw", auth: true,
+			contentType: fiber.MIMEApplicationJSON, body: `{"order":"2377225624","sum":"-100.00"}`, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "withdraw zero sum v1", method: http.MethodPost, target: "/api/user/balance/withdraw", auth: true,
+			contentType: fiber.MIMEApplicationJSON, body: `{"order":"2377225624","sum":0}`, wantStatus: http.StatusBadRequest,
+		},
+		{name: "statement format", method: http.MethodGet, target: "/api/v2/user/statement?format=xml", auth: true, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(fiber.HeaderContentType, tt.contentType)
+			}
+			if tt.auth {
+				tt.cookie = token
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "jwt", Value: tt.cookie})
+			}
+
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			specReq := httptest.NewRequest(tt.method, tt.target, nil)
+			route, pathParams, err := router.FindRoute(specReq)
+			if err != nil {
+				t.Fatalf("route not found in specification: %v", err)
+			}
+
+			err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request:    specReq,
+					PathParams: pathParams,
+					Route:      route,
+				},
+				Status: resp.StatusCode,
+				Header: resp.Header,
+				Body:   io.NopCloser(bytes.NewReader(body)),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+				},
+			})
+			if err != nil {
+				t.Fatalf("response does not match specification: %v\nbody: %s", err, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package accrualtest
+
+import (
+	"net/http/httptest"
+)
+
+// Server — симулятор на httptest.Server; URL подходит как адрес системы расчёта для accrual.New
+type Server struct {
+	*httptest.Server
+	*Simulator
+}
+
+// NewServer запускает симулятор на локальном порту; остановить его нужно через Close
+func NewServer(opts Options) *Server {
+	simulator := New(opts)
+	return &Server{
+		Server:    httptest.NewServer(simulator),
+		Simulator: simulator,
+	}
+}
@@ -0,0 +1,452 @@
+// Package accrualtest — симулятор системы расчёта начислений для тестов и локального запуска.
+// Реализует API системы расчёта (регистрация заказов и правил вознаграждения, статус заказа)
+// и позволяет задавать поведение: задержку расчёта, медленные ответы, 204, 429 и 500
+package accrualtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+// DefaultRetryAfter — Retry-After для 429, если в Options и шаге сценария он не задан
+const DefaultRetryAfter = time.Minute
+
+// Reward — правило вознаграждения: товары, в описании которых есть Match, приносят Reward
+// процентов от цены (RewardPercent) или Reward баллов (RewardPoints)
+type Reward struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+// Duration — time.Duration, который в JSON записывается строкой вида "1.5s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(value)
+	return nil
+}
+
+// Step — один ответ сценария на GET /api/orders/{number}. Code = 0 или 200 отдаёт статус заказа:
+// Status и Accrual, если заданы, иначе вычисленные симулятором. Code 204, 429 и 500 отдаются как есть
+type Step struct {
+	Code       int      `json:"code,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Accrual    *float64 `json:"accrual,omitempty"`
+	RetryAfter Duration `json:"retry_after,omitempty"`
+	Delay      Duration `json:"delay,omitempty"`
+}
+
+// Options — поведение симулятора по умолчанию
+type Options struct {
+	// ProcessingDelay — сколько заказ остаётся в REGISTERED и затем в PROCESSING
+	ProcessingDelay time.Duration
+	// ResponseDelay — задержка перед каждым ответом API
+	ResponseDelay time.Duration
+	// RateLimit — сколько GET /api/orders/{number} в минуту обслуживается до ответа 429; 0 — без ограничения
+	RateLimit int
+	// RetryAfter — значение заголовка Retry-After в ответе 429
+	RetryAfter time.Duration
+	// FailEvery — каждый FailEvery-й запрос к API завершается 500; 0 — без ошибок
+	FailEvery int
+	// Rewards — правила вознаграждения, доступные сразу после запуска
+	Rewards []Reward
+	// Scripts — сценарии ответов по номерам заказов
+	Scripts map[string][]Step
+}
+
+type order struct {
+	number       string
+	goods        []accrual.Good
+	registeredAt time.Time
+	final        *accrual.OrderStatus
+}
+
+// Simulator — http.Handler с API системы расчёта
+type Simulator struct {
+	opts Options
+	mux  *http.ServeMux
+	// Now подменяет текущее время в тестах
+	Now func() time.Time
+
+	mu       sync.Mutex
+	orders   map[string]*order
+	rewards  []Reward
+	scripts  map[string][]Step
+	requests []time.Time
+	served   int
+}
+
+func New(opts Options) *Simulator {
+	s := &Simulator{
+		opts:    opts,
+		mux:     http.NewServeMux(),
+		Now:     time.Now,
+		orders:  make(map[string]*order),
+		rewards: append([]Reward(nil), opts.Rewards...),
+		scripts: make(map[string][]Step),
+	}
+	for number, steps := range opts.Scripts {
+		s.scripts[number] = append([]Step(nil), steps...)
+	}
+
+	s.mux.HandleFunc("POST /api/orders", s.registerOrder)
+	s.mux.HandleFunc("GET /api/orders/{number}", s.getOrder)
+	s.mux.HandleFunc("POST /api/goods", s.registerReward)
+	s.mux.HandleFunc("POST /sim/script", s.scriptHandler)
+	s.mux.HandleFunc("POST /sim/reset", s.resetHandler)
+
+	return s
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		if !s.sleep(r, s.opts.ResponseDelay) {
+			return
+		}
+		if s.shouldFail() {
+			http.Error(w, "simulated internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Script задаёт сценарий ответов для заказа; шаги расходуются по одному на запрос,
+// после последнего симулятор отвечает как обычно
+func (s *Simulator) Script(number string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[number] = append([]Step(nil), steps...)
+}
+
+// AddReward добавляет правило вознаграждения; false, если правило с таким Match уже есть
+func (s *Simulator) AddReward(reward Reward) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.rewards {
+		if existing.Match == reward.Match {
+			return false
+		}
+	}
+	s.rewards = append(s.rewards, reward)
+	return true
+}
+
+// Registered возвращает заказы, переданные в систему расчёта, по номеру
+func (s *Simulator) Registered() map[string][]accrual.Good {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registered := make(map[string][]accrual.Good, len(s.orders))
+	for number, o := range s.orders {
+		registered[number] = append([]accrual.Good(nil), o.goods...)
+	}
+	return registered
+}
+
+// Reset забывает заказы, сценарии и счётчики запросов; правила из Options восстанавливаются
+func (s *Simulator) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orders = make(map[string]*order)
+	s.rewards = append([]Reward(nil), s.opts.Rewards...)
+	s.scripts = make(map[string][]Step)
+	for number, steps := range s.opts.Scripts {
+		s.scripts[number] = append([]Step(nil), steps...)
+	}
+	s.requests = nil
+	s.served = 0
+}
+
+func (s *Simulator) registerOrder(w http.ResponseWriter, r *http.Request) {
+	var request accrual.Order
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !isValidNumber(request.Number) {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[request.Number]; ok {
+		http.Error(w, "order is already registered", http.StatusConflict)
+		return
+	}
+
+	s.orders[request.Number] = &order{
+		number:       request.Number,
+		goods:        request.Goods,
+		registeredAt: s.Now(),
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Simulator) registerReward(w http.ResponseWriter, r *http.Request) {
+	var reward Reward
+	if err := json.NewDecoder(r.Body).Decode(&reward); err != nil || reward.Match == "" || reward.Reward < 0 ||
+		(reward.RewardType != RewardPercent && reward.RewardType != RewardPoints) {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if !s.AddReward(reward) {
+		http.Error(w, "reward is already registered", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Simulator) getOrder(w http.ResponseWriter, r *http.Request) {
+	number := r.PathValue("number")
+
+	if step, ok := s.nextStep(number); ok {
+		if !s.sleep(r, time.Duration(step.Delay)) {
+			return
+		}
+		switch step.Code {
+		case 0, http.StatusOK:
+		case http.StatusTooManyRequests:
+			s.writeRateLimit(w, time.Duration(step.RetryAfter))
+			return
+		default:
+			w.WriteHeader(step.Code)
+			return
+		}
+
+		status, ok := s.status(number)
+		if !ok {
+			status = accrual.OrderStatus{Order: number}
+		}
+		if step.Status != "" {
+			status.Status = step.Status
+		}
+		if step.Accrual != nil {
+			status.Accrual = *step.Accrual
+		}
+		writeJSON(w, status)
+		return
+	}
+
+	if !s.allowRequest() {
+		s.writeRateLimit(w, 0)
+		return
+	}
+
+	status, ok := s.status(number)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, status)
+}
+
+// status вычисляет статус заказа по времени с момента регистрации; начисление считается
+// один раз при переходе в финальный статус по правилам, действующим в этот момент
+func (s *Simulator) status(number string) (accrual.OrderStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		return accrual.OrderStatus{}, false
+	}
+	if o.final != nil {
+		return *o.final, true
+	}
+
+	elapsed := s.Now().Sub(o.registeredAt)
+	switch {
+	case elapsed < s.opts.ProcessingDelay:
+		return accrual.OrderStatus{Order: number, Status: accrual.StatusRegistered}, true
+	case elapsed < 2*s.opts.ProcessingDelay:
+		return accrual.OrderStatus{Order: number, Status: accrual.StatusProcessing}, true
+	}
+
+	o.final = &accrual.OrderStatus{
+		Order:   number,
+		Status:  accrual.StatusProcessed,
+		Accrual: calculateAccrual(o.goods, s.rewards),
+	}
+	return *o.final, true
+}
+
+func calculateAccrual(goods []accrual.Good, rewards []Reward) float64 {
+	var total float64
+	for _, good := range goods {
+		for _, reward := range rewards {
+			if !strings.Contains(good.Description, reward.Match) {
+				continue
+			}
+			if reward.RewardType == RewardPercent {
+				total += good.Price * reward.Reward / 100
+			} else {
+				total += reward.Reward
+			}
+			break
+		}
+	}
+	return math.Round(total*100) / 100
+}
+
+func (s *Simulator) nextStep(number string) (Step, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	steps := s.scripts[number]
+	if len(steps) == 0 {
+		return Step{}, false
+	}
+	s.scripts[number] = steps[1:]
+	return steps[0], true
+}
+
+// allowRequest считает запросы статуса за последнюю минуту
+func (s *Simulator) allowRequest() bool {
+	if s.opts.RateLimit <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	window := s.requests[:0]
+	for _, at := range s.requests {
+		if now.Sub(at) < time.Minute {
+			window = append(window, at)
+		}
+	}
+	s.requests = window
+
+	if len(s.requests) >= s.opts.RateLimit {
+		return false
+	}
+	s.requests = append(s.requests, now)
+	return true
+}
+
+func (s *Simulator) shouldFail() bool {
+	if s.opts.FailEvery <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.served++
+	return s.served%s.opts.FailEvery == 0
+}
+
+func (s *Simulator) writeRateLimit(w http.ResponseWriter, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = s.opts.RetryAfter
+	}
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintf(w, "No more than %d requests per minute allowed", s.opts.RateLimit)
+}
+
+// sleep ждёт delay и возвращает false, если клиент ушёл раньше
+func (s *Simulator) sleep(r *http.Request, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+type scriptRequest struct {
+	Order string `json:"order"`
+	Steps []Step `json:"steps"`
+}
+
+// scriptHandler задаёт сценарий заказа у запущенного симулятора
+func (s *Simulator) scriptHandler(w http.ResponseWriter, r *http.Request) {
+	var request scriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Order == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.Script(request.Order, request.Steps...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) resetHandler(w http.ResponseWriter, r *http.Request) {
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status accrual.OrderStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// isValidNumber проверяет номер заказа алгоритмом Луна
+func isValidNumber(number string) bool {
+	if number == "" {
+		return false
+	}
+
+	var sum int
+	var double bool
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+
+		n := int(number[i] - '0')
+		if double {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,162 @@
+package accrualtest
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	orderNumber = "12345678903"
+	otherNumber = "2377225624"
+)
+
+// clock — управляемое время симулятора
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// TestHTTPClientLifecycle проводит заказ через REGISTERED → PROCESSING → PROCESSED
+// клиентом accrual.HTTPClient
+func TestHTTPClientLifecycle(t *testing.T) {
+	ctx := context.Background()
+	const delay = time.Second
+
+	srv := NewServer(Options{
+		ProcessingDelay: delay,
+		Rewards:         []Reward{{Match: "Bork", Reward: 10, RewardType: RewardPercent}},
+	})
+	defer srv.Close()
+
+	c := &clock{now: time.Now()}
+	srv.Now = c.Now
+
+	client := accrual.New(srv.URL, accrual.Options{})
+
+	err := client.RegisterOrder(ctx, accrual.Order{
+		Number: orderNumber,
+		Goods:  []accrual.Good{{Description: "Чайник Bork", Price: 7000}, {Description: "Кружка", Price: 500}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.RegisterOrder(ctx, accrual.Order{Number: orderNumber}); !errors.Is(err, accrual.ErrOrderAlreadyRegistered) {
+		t.Fatalf("second registration err = %v, want ErrOrderAlreadyRegistered", err)
+	}
+
+	for _, want := range []accrual.OrderStatus{
+		{Order: orderNumber, Status: accrual.StatusRegistered},
+		{Order: orderNumber, Status: accrual.StatusProcessing},
+		{Order: orderNumber, Status: accrual.StatusProcessed, Accrual: 700},
+	} {
+		status, err := client.GetOrder(ctx, orderNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != want {
+			t.Fatalf("status = %+v, want %+v", status, want)
+		}
+		c.Advance(delay)
+	}
+
+	if goods := srv.Registered()[orderNumber]; len(goods) != 2 {
+		t.Fatalf("registered goods = %+v, want 2 items", goods)
+	}
+}
+
+// TestHTTPClientErrors проверяет, как клиент видит ответы 204, 429 и 500 симулятора
+func TestHTTPClientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not registered", func(t *testing.T) {
+		srv := NewServer(Options{})
+		defer srv.Close()
+
+		_, err := accrual.New(srv.URL, accrual.Options{}).GetOrder(ctx, orderNumber)
+		if !errors.Is(err, accrual.ErrOrderNotRegistered) {
+			t.Fatalf("err = %v, want ErrOrderNotRegistered", err)
+		}
+	})
+
+	t.Run("scripted rate limit", func(t *testing.T) {
+		srv := NewServer(Options{})
+		defer srv.Close()
+		srv.Script(orderNumber, Step{Code: http.StatusTooManyRequests, RetryAfter: Duration(5 * time.Second)})
+
+		_, err := accrual.New(srv.URL, accrual.Options{}).GetOrder(ctx, orderNumber)
+		var rateLimitErr *accrual.RateLimitError
+		if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != 5*time.Second {
+			t.Fatalf("err = %v, want rate limit with retry after 5s", err)
+		}
+	})
+
+	t.Run("rate limit option", func(t *testing.T) {
+		srv := NewServer(Options{RateLimit: 1, RetryAfter: 10 * time.Second})
+		defer srv.Close()
+		client := accrual.New(srv.URL, accrual.Options{})
+
+		if _, err := client.GetOrder(ctx, orderNumber); !errors.Is(err, accrual.ErrOrderNotRegistered) {
+			t.Fatalf("first request err = %v, want ErrOrderNotRegistered", err)
+		}
+		_, err := client.GetOrder(ctx, otherNumber)
+		var rateLimitErr *accrual.RateLimitError
+		if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != 10*time.Second {
+			t.Fatalf("second request err = %v, want rate limit with retry after 10s", err)
+		}
+	})
+
+	t.Run("scripted server error", func(t *testing.T) {
+		srv := NewServer(Options{})
+		defer srv.Close()
+		srv.Script(orderNumber, Step{Code: http.StatusInternalServerError}, Step{Code: http.StatusNoContent})
+		client := accrual.New(srv.URL, accrual.Options{})
+
+		_, err := client.GetOrder(ctx, orderNumber)
+		var statusErr *accrual.StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusInternalServerError {
+			t.Fatalf("err = %v, want status error 500", err)
+		}
+		if _, err = client.GetOrder(ctx, orderNumber); !errors.Is(err, accrual.ErrOrderNotRegistered) {
+			t.Fatalf("next step err = %v, want ErrOrderNotRegistered", err)
+		}
+	})
+
+	t.Run("fail every request", func(t *testing.T) {
+		srv := NewServer(Options{FailEvery: 1})
+		defer srv.Close()
+
+		err := accrual.New(srv.URL, accrual.Options{}).RegisterOrder(ctx, accrual.Order{Number: orderNumber})
+		var statusErr *accrual.StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusInternalServerError {
+			t.Fatalf("err = %v, want status error 500", err)
+		}
+	})
+
+	t.Run("invalid number", func(t *testing.T) {
+		srv := NewServer(Options{})
+		defer srv.Close()
+
+		err := accrual.New(srv.URL, accrual.Options{}).RegisterOrder(ctx, accrual.Order{Number: "12345678904"})
+		var statusErr *accrual.StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadRequest {
+			t.Fatalf("err = %v, want status error 400", err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen — запрос не отправлен: система расчёта считается недоступной
+var ErrCircuitOpen = errors.New("accrual circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+const (
+	DefaultBreakerFailures         = 5
+	DefaultBreakerOpenTimeout      = 30 * time.Second
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+type BreakerOptions struct {
+	// Failures — число ошибок подряд, после которого цепь размыкается
+	Failures int
+	// OpenTimeout — сколько цепь остаётся разомкнутой до пробных запросов
+	OpenTimeout time.Duration
+	// HalfOpenRequests — число пробных запросов; все должны пройти успешно, чтобы цепь замкнулась
+	HalfOpenRequests int
+}
+
+// Breaker — Client с автоматическим выключателем: пока цепь разомкнута, запросы
+// сразу завершаются ErrCircuitOpen, не нагружая упавшую систему расчёта
+type Breaker struct {
+	client Client
+	opts   BreakerOptions
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	inFlight  int
+	successes int
+}
+
+func NewBreaker(client Client, opts BreakerOptions) *Breaker {
+	if opts.Failures <= 0 {
+		opts.Failures = DefaultBreakerFailures
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = DefaultBreakerOpenTimeout
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+
+	metrics.AccrualCircuitState.Set(float64(BreakerClosed))
+	return &Breaker{client: client, opts: opts}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Unwrap возвращает клиент без выключателя, например для проверок готовности,
+// которые не должны влиять на состояние цепи
+func (b *Breaker) Unwrap() Client {
+	return b.client
+}
+
+func (b *Breaker) RegisterOrder(ctx context.Context, order Order) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := b.client.RegisterOrder(ctx, order)
+	b.done(err)
+	return err
+}
+
+func (b *Breaker) GetOrder(ctx context.Context, number string) (OrderStatus, error) {
+	if err := b.allow(); err != nil {
+		return OrderStatus{}, err
+	}
+
+	status, err := b.client.GetOrder(ctx, number)
+	b.done(err)
+	return status, err
+}
+
+func (b *Breaker) Ping(ctx context.Context) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := b.client.Ping(ctx)
+	b.done(err)
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.OpenTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.inFlight >= b.opts.HalfOpenRequests {
+			return ErrCircuitOpen
+		}
+		b.inFlight++
+	}
+	return nil
+}
+
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := isFailure(err)
+
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.opts.Failures {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		b.inFlight--
+		if failed {
+			b.setState(BreakerOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.HalfOpenRequests {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// setState вызывается под b.mu
+func (b *Breaker) setState(state BreakerState) {
+	b.state = state
+	b.failures = 0
+	b.inFlight = 0
+	b.successes = 0
+	if state == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+
+	metrics.AccrualCircuitState.Set(float64(state))
+	metrics.AccrualCircuitTransitions.WithLabelValues(state.String()).Inc()
+	logger.Log.Warn("Accrual circuit breaker state changed", zap.Stringer("state", state))
+}
+
+// isFailure отделяет недоступность системы расчёта от ответов, которые она дала осознанно:
+// 4xx, 204 и 429 цепь не размыкают
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, ErrOrderNotRegistered) ||
+		errors.Is(err, ErrOrderAlreadyRegistered) ||
+		errors.Is(err, ErrInvalidResponse) {
+		return false
+	}
+
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= http.StatusInternalServerError
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestBreakerTransitions проверяет цикл closed → open → half-open → closed на Fake
+func TestBreakerTransitions(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+	fake.SetStatus(OrderStatus{Order: "1", Status: StatusProcessed, Accrual: 100})
+
+	breaker := NewBreaker(fake, BreakerOptions{Failures: 2, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 1})
+
+	// Ответы, которые система расчёта дала осознанно, цепь не размыкают
+	for _, err := range []error{ErrOrderNotRegistered, &RateLimitError{RetryAfter: time.Second}, &StatusError{Code: http.StatusBadRequest}} {
+		fake.SetError("1", err)
+		for i := 0; i < 3; i++ {
+			breaker.GetOrder(ctx, "1")
+		}
+		if state := breaker.State(); state != BreakerClosed {
+			t.Fatalf("state after %v = %s, want closed", err, state)
+		}
+	}
+
+	fake.SetError("1", &StatusError{Code: http.StatusInternalServerError})
+	for i := 0; i < 2; i++ {
+		breaker.GetOrder(ctx, "1")
+	}
+	if state := breaker.State(); state != BreakerOpen {
+		t.Fatalf("state after failures = %s, want open", state)
+	}
+	if _, err := breaker.GetOrder(ctx, "1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if state := breaker.State(); state != BreakerHalfOpen {
+		t.Fatalf("state after open timeout = %s, want half_open", state)
+	}
+
+	// Неудачный пробный запрос снова размыкает цепь
+	breaker.GetOrder(ctx, "1")
+	if state := breaker.State(); state != BreakerOpen {
+		t.Fatalf("state after failed probe = %s, want open", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	fake.SetError("1", nil)
+	status, err := breaker.GetOrder(ctx, "1")
+	if err != nil || status.Accrual != 100 {
+		t.Fatalf("probe = %+v, %v, want processed order", status, err)
+	}
+	if state := breaker.State(); state != BreakerClosed {
+		t.Fatalf("state after successful probe = %s, want closed", state)
+	}
+}
@@ -0,0 +1,222 @@
+package accrual
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxIdleConns = 10
+	// DefaultRetryAfter используется, если ответ 429 пришёл без Retry-After
+	DefaultRetryAfter = time.Minute
+	// maxResponseSize ограничивает чтение тела ответа
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrOrderNotRegistered — система расчёта не знает заказ (204 No Content)
+	ErrOrderNotRegistered = errors.New("order is not registered in accrual system")
+	// ErrOrderAlreadyRegistered — заказ уже был передан в систему расчёта (409 Conflict)
+	ErrOrderAlreadyRegistered = errors.New("order is already registered in accrual system")
+	ErrInvalidResponse        = errors.New("invalid accrual system response")
+)
+
+// RateLimitError — система расчёта ответила 429 и просит не обращаться к ней RetryAfter
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("accrual system rate limit, retry after %s", e.RetryAfter)
+}
+
+// StatusError — неожиданный код ответа системы расчёта
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected accrual system status code: %d", e.Code)
+}
+
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+type Order struct {
+	Number string `json:"order"`
+	Goods  []Good `json:"goods"`
+}
+
+type OrderStatus struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual,omitempty"`
+}
+
+// Client — операции с системой расчёта баллов лояльности
+type Client interface {
+	// RegisterOrder передаёт заказ на расчёт
+	RegisterOrder(ctx context.Context, order Order) error
+	// GetOrder возвращает текущий статус расчёта по заказу
+	GetOrder(ctx context.Context, number string) (OrderStatus, error)
+	// Ping проверяет, что система расчёта отвечает без 5xx
+	Ping(ctx context.Context) error
+}
+
+// Default — клиент, которым пользуются обработчики и воркеры; настраивается в main
+var Default Client = New("", Options{})
+
+type Options struct {
+	// Timeout ограничивает весь запрос, включая чтение ответа
+	Timeout time.Duration
+	// MaxIdleConns — число keep-alive соединений, которые держатся открытыми
+	MaxIdleConns int
+	TLSConfig    *tls.Config
+}
+
+// HTTPClient — реализация Client поверх HTTP API системы расчёта
+type HTTPClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func New(baseURL string, opts Options) *HTTPClient {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.MaxIdleConns
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	transport.TLSClientConfig = opts.TLSConfig
+
+	return &HTTPClient{
+		baseURL: baseURL,
+		http: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: otelhttp.NewTransport(transport),
+		},
+	}
+}
+
+func (c *HTTPClient) RegisterOrder(ctx context.Context, order Order) error {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/orders", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return nil
+	case http.StatusConflict:
+		return ErrOrderAlreadyRegistered
+	default:
+		return statusError(resp)
+	}
+}
+
+func (c *HTTPClient) GetOrder(ctx context.Context, number string) (OrderStatus, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/orders/"+url.PathEscape(number), nil)
+	if err != nil {
+		return OrderStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return OrderStatus{}, ErrOrderNotRegistered
+	default:
+		return OrderStatus{}, statusError(resp)
+	}
+
+	var status OrderStatus
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&status); err != nil {
+		return OrderStatus{}, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	switch status.Status {
+	case StatusRegistered, StatusInvalid, StatusProcessing, StatusProcessed:
+	default:
+		return OrderStatus{}, fmt.Errorf("%w: unknown status %q", ErrInvalidResponse, status.Status)
+	}
+
+	return status, nil
+}
+
+func (c *HTTPClient) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &StatusError{Code: resp.StatusCode}
+	}
+	return nil
+}
+
+func (c *HTTPClient) do(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		metrics.AccrualResponses.WithLabelValues("error").Inc()
+		return nil, err
+	}
+
+	metrics.AccrualResponses.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	return resp, nil
+}
+
+// statusError переводит код ответа в ошибку и дочитывает тело, чтобы соединение вернулось в пул
+func statusError(resp *http.Response) error {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := DefaultRetryAfter
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+
+	return &StatusError{Code: resp.StatusCode}
+}
@@ -0,0 +1,107 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHTTPClientStatusMapping проверяет перевод ответов системы расчёта в ошибки клиента
+// и то, какие из них выключатель считает отказом
+func TestHTTPClientStatusMapping(t *testing.T) {
+	tests := []struct {
+		name        string
+		register    bool
+		status      int
+		retryAfter  string
+		body        string
+		wantErr     error
+		wantStatus  *StatusError
+		wantRetry   time.Duration
+		wantFailure bool
+	}{
+		{name: "processed", status: http.StatusOK, body: `{"order":"1","status":"PROCESSED","accrual":500}`},
+		{name: "not registered", status: http.StatusNoContent, wantErr: ErrOrderNotRegistered},
+		{name: "unknown status", status: http.StatusOK, body: `{"order":"1","status":"DONE"}`, wantErr: ErrInvalidResponse},
+		{name: "malformed body", status: http.StatusOK, body: `{`, wantErr: ErrInvalidResponse},
+		{name: "rate limit", status: http.StatusTooManyRequests, retryAfter: "7", wantRetry: 7 * time.Second},
+		{name: "rate limit without retry-after", status: http.StatusTooManyRequests, wantRetry: DefaultRetryAfter},
+		{name: "server error", status: http.StatusInternalServerError, wantStatus: &StatusError{Code: http.StatusInternalServerError}, wantFailure: true},
+		{name: "bad gateway", status: http.StatusBadGateway, wantStatus: &StatusError{Code: http.StatusBadGateway}, wantFailure: true},
+		{name: "register accepted", register: true, status: http.StatusAccepted},
+		{name: "register conflict", register: true, status: http.StatusConflict, wantErr: ErrOrderAlreadyRegistered},
+		{name: "register bad request", register: true, status: http.StatusBadRequest, wantStatus: &StatusError{Code: http.StatusBadRequest}},
+		{name: "register server error", register: true, status: http.StatusServiceUnavailable, wantStatus: &StatusError{Code: http.StatusServiceUnavailable}, wantFailure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client := New(srv.URL, Options{})
+
+			var err error
+			if tt.register {
+				err = client.RegisterOrder(context.Background(), Order{Number: "1"})
+			} else {
+				var status OrderStatus
+				status, err = client.GetOrder(context.Background(), "1")
+				if err == nil && status.Status != StatusProcessed {
+					t.Fatalf("status = %q, want %q", status.Status, StatusProcessed)
+				}
+			}
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantStatus != nil:
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.Code != tt.wantStatus.Code {
+					t.Fatalf("err = %v, want %v", err, tt.wantStatus)
+				}
+			case tt.wantRetry > 0:
+				var rateLimitErr *RateLimitError
+				if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter != tt.wantRetry {
+					t.Fatalf("err = %v, want rate limit with retry after %s", err, tt.wantRetry)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := isFailure(err); got != tt.wantFailure {
+				t.Fatalf("isFailure(%v) = %t, want %t", err, got, tt.wantFailure)
+			}
+		})
+	}
+}
+
+// TestIsFailureTransportErrors — сетевые ошибки размыкают цепь, отмена запроса вызывающим — нет
+func TestIsFailureTransportErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	_, err := New(url, Options{}).GetOrder(context.Background(), "1")
+	if err == nil || !isFailure(err) {
+		t.Fatalf("connection error %v must be a failure", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New(url, Options{}).GetOrder(ctx, "1")
+	if !errors.Is(err, context.Canceled) || isFailure(err) {
+		t.Fatalf("canceled request %v must not be a failure", err)
+	}
+}
@@ -0,0 +1,79 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+)
+
+// Fake — реализация Client в памяти для тестов и локального запуска без системы расчёта
+type Fake struct {
+	mu         sync.Mutex
+	statuses   map[string]OrderStatus
+	errors     map[string]error
+	registered []Order
+	// PingErr возвращается из Ping
+	PingErr error
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		statuses: make(map[string]OrderStatus),
+		errors:   make(map[string]error),
+	}
+}
+
+// SetStatus задаёт ответ GetOrder для заказа
+func (f *Fake) SetStatus(status OrderStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[status.Order] = status
+}
+
+// SetError заставляет RegisterOrder и GetOrder возвращать err для заказа
+func (f *Fake) SetError(number string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[number] = err
+}
+
+// Registered возвращает заказы, переданные в RegisterOrder
+func (f *Fake) Registered() []Order {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Order(nil), f.registered...)
+}
+
+func (f *Fake) RegisterOrder(ctx context.Context, order Order) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.errors[order.Number]; err != nil {
+		return err
+	}
+	if _, ok := f.statuses[order.Number]; ok {
+		return ErrOrderAlreadyRegistered
+	}
+
+	f.registered = append(f.registered, order)
+	f.statuses[order.Number] = OrderStatus{Order: order.Number, Status: StatusRegistered}
+	return nil
+}
+
+func (f *Fake) GetOrder(ctx context.Context, number string) (OrderStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.errors[number]; err != nil {
+		return OrderStatus{}, err
+	}
+
+	status, ok := f.statuses[number]
+	if !ok {
+		return OrderStatus{}, ErrOrderNotRegistered
+	}
+	return status, nil
+}
+
+func (f *Fake) Ping(ctx context.Context) error {
+	return f.PingErr
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/metrics"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const ShutdownTimeout = 5 * time.Second
+
+// Serve запускает служебный HTTP-сервер, недоступный через публичный RunAddress,
+// и останавливает его после отмены ctx. Всё, кроме /metrics, закрыто учётными данными администратора.
+// С tlsConfig сервер работает по HTTPS
+func Serve(ctx context.Context, address string, tlsConfig *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	mux.Handle("GET /admin/audit", requireAdmin(http.HandlerFunc(auditHandler)))
+	mux.Handle("GET /admin/audit/export", requireAdmin(http.HandlerFunc(auditExportHandler)))
+	mux.Handle("/admin/log/level", requireAdmin(logger.Level))
+	registerDebug(mux)
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Log.Info("Running admin server", zap.String("address", address), zap.Bool("tls", tlsConfig != nil))
+
+	var err error
+	if tlsConfig != nil {
+		// Сертификат берётся из TLSConfig.GetCertificate
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
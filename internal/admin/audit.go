@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+var errInvalidAuditFilter = errors.New("invalid audit filter")
+
+// auditHandler отдаёт записи журнала аудита JSON-массивом; фильтры:
+// actor_id, action, from и to (RFC 3339), limit
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditLimit
+	}
+	if filter.Limit > MaxAuditLimit {
+		filter.Limit = MaxAuditLimit
+	}
+
+	entries := []models.AuditEntry{}
+	err = storage.StreamAuditEntries(r.Context(), filter, func(entry models.AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Error getting audit entries", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// auditExportHandler выгружает журнал аудита в формате JSON Lines без ограничения по количеству
+func auditExportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+
+	encoder := json.NewEncoder(w)
+	err = storage.StreamAuditEntries(r.Context(), filter, func(entry models.AuditEntry) error {
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		// Заголовки уже отправлены — обрываем выгрузку и пишем в лог
+		logger.Log.Error("Error exporting audit entries", zap.Error(err))
+	}
+}
+
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	var filter models.AuditFilter
+	query := r.URL.Query()
+
+	if actorID := query.Get("actor_id"); actorID != "" {
+		id, err := uuid.Parse(actorID)
+		if err != nil {
+			return filter, errInvalidAuditFilter
+		}
+		filter.ActorID = &id
+	}
+
+	filter.Action = query.Get("action")
+
+	for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, errInvalidAuditFilter
+			}
+			*target = t
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, errInvalidAuditFilter
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
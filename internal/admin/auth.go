@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"github.com/sol1corejz/goferrrmart/cmd/config"
+	"net/http"
+)
+
+// requireAdmin закрывает служебные эндпоинты: пропускает клиентов с сертификатом, проверенным
+// по admin_client_ca_file, остальным нужна basic-аутентификация; без пароля они недоступны
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if config.Current.AdminPassword == "" {
+			http.Error(w, "admin credentials are not configured", http.StatusForbidden)
+			return
+		}
+
+		user, password, ok := r.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(config.Current.AdminUser)) == 1
+		passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(config.Current.AdminPassword)) == 1
+		if !ok || !userMatch || !passwordMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gophermart-admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
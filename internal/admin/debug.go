@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/cmd/config"
+	"github.com/sol1corejz/goferrrmart/internal/workers"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+var startedAt = time.Now()
+
+func init() {
+	expvar.Publish("runtime", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"go_version": runtime.Version(),
+			"goroutines": runtime.NumGoroutine(),
+			"num_cpu":    runtime.NumCPU(),
+			"uptime":     time.Since(startedAt).String(),
+		}
+	}))
+	expvar.Publish("loyalty_worker", expvar.Func(func() interface{} {
+		return workers.Status()
+	}))
+}
+
+func registerDebug(mux *http.ServeMux) {
+	mux.Handle("/debug/pprof/", requireAdmin(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/profile", requireAdmin(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", requireAdmin(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", requireAdmin(http.HandlerFunc(pprof.Trace)))
+	mux.Handle("GET /debug/vars", requireAdmin(http.HandlerFunc(varsHandler)))
+	mux.Handle("GET /debug/config", requireAdmin(http.HandlerFunc(configHandler)))
+	mux.Handle("GET /debug/workers", requireAdmin(http.HandlerFunc(workersHandler)))
+}
+
+// varsHandler повторяет формат expvar.Handler, но без "cmdline":
+// в аргументах запуска могут быть пароли
+func varsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprint(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprint(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprint(w, "\n}\n")
+}
+
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Redacted())
+}
+
+func workersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"loyalty": workers.Status(),
+	})
+}
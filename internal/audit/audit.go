@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Entry собирает запись журнала аудита с IP, user-agent и requestID текущего запроса
+func Entry(c *fiber.Ctx, action string, actorID uuid.UUID, actorLogin string, details map[string]interface{}) (models.AuditEntry, error) {
+	entry := models.AuditEntry{
+		Action:     action,
+		ActorLogin: actorLogin,
+		IP:         c.IP(),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+	}
+
+	if actorID != uuid.Nil {
+		entry.ActorID = &actorID
+	}
+	if requestID, ok := c.Locals("requestID").(string); ok {
+		entry.RequestID = requestID
+	}
+
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return models.AuditEntry{}, err
+		}
+		entry.Details = data
+	}
+
+	return entry, nil
+}
+
+// Record пишет запись в журнал аудита отдельно от действия. Ошибка записи только логируется:
+// действие пользователя уже выполнено. Денежные операции пишут запись в своей транзакции через Entry
+func Record(c *fiber.Ctx, action string, actorID uuid.UUID, actorLogin string, details map[string]interface{}) {
+	entry, err := Entry(c, action, actorID, actorLogin, details)
+	if err != nil {
+		middleware.Logger(c).Error("Error encoding audit details", zap.String("action", action), zap.Error(err))
+		return
+	}
+
+	if err = storage.CreateAuditEntry(c.UserContext(), entry); err != nil {
+		middleware.Logger(c).Error("Error writing audit entry", zap.String("action", action), zap.Error(err))
+	}
+}
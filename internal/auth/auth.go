@@ -55,20 +55,20 @@ func GetUserID(tokenString string) (uuid.UUID, error) {
 	})
 
 	if err != nil {
-		logger.Log.Warn("Error parsing token:", zap.Error(err))
+		logger.Auth.Warn("Error parsing token:", zap.Error(err))
 		return uuid.Nil, errors.New("invalid token")
 	}
 
 	if !token.Valid {
-		logger.Log.Info("Token is not valid")
+		logger.Auth.Info("Token is not valid")
 		return uuid.Nil, errors.New("token is not valid")
 	}
 
 	if claims.UserID == uuid.Nil {
-		logger.Log.Warn("Parsed UserID is nil")
+		logger.Auth.Warn("Parsed UserID is nil")
 		return uuid.Nil, errors.New("user ID is nil")
 	}
 
-	logger.Log.Info("Token is valid")
+	logger.Auth.Debug("Token is valid")
 	return claims.UserID, nil
 }
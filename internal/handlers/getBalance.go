@@ -1,13 +1,12 @@
 package handlers
 
 import (
-	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
 	"github.com/sol1corejz/goferrrmart/internal/storage"
 	"go.uber.org/zap"
-	"time"
 )
 
 type BalanceResponse struct {
@@ -16,28 +15,41 @@ type BalanceResponse struct {
 }
 
 func GetUserBalanceHandler(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	select {
-	case <-ctx.Done():
-		logger.Log.Warn("Context canceled or timeout exceeded")
-		return c.Status(fiber.StatusRequestTimeout).JSON(fiber.Map{
-			"error": "Request timed out",
-		})
-	default:
-		userID := c.Locals("userID").(uuid.UUID)
-
-		balance, err := storage.GetUserBalance(ctx, userID)
-
-		if err != nil {
-			logger.Log.Error("Error getting user orders", zap.Error(err))
-			return c.SendStatus(fiber.StatusInternalServerError)
-		}
-
-		return c.Status(fiber.StatusOK).JSON(BalanceResponse{
-			Current:   balance.CurrentBalance,
-			Withdrawn: balance.WithdrawnTotal,
-		})
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	balance, err := storage.GetUserBalance(ctx, userID)
+
+	if err != nil {
+		middleware.Logger(c).Error("Error getting user orders", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	return c.Status(fiber.StatusOK).JSON(BalanceResponse{
+		Current:   balance.CurrentBalance,
+		Withdrawn: balance.WithdrawnTotal,
+	})
+}
+
+type BalanceResponseV2 struct {
+	Current   Amount `json:"current"`
+	Withdrawn Amount `json:"withdrawn"`
+}
+
+func GetUserBalanceV2Handler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	balance, err := storage.GetUserBalance(ctx, userID)
+	if err != nil {
+		middleware.Logger(c).Error("Error getting user balance", zap.Error(err))
+		return problem.ErrInternal
 	}
+
+	return c.Status(fiber.StatusOK).JSON(BalanceResponseV2{
+		Current:   Amount(balance.CurrentBalance),
+		Withdrawn: Amount(balance.WithdrawnTotal),
+	})
 }
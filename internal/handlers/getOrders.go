@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"context"
+	"database/sql"
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
 	"github.com/sol1corejz/goferrrmart/internal/storage"
 	"go.uber.org/zap"
 	"time"
@@ -18,40 +20,118 @@ type OrderResponse struct {
 }
 
 func GetOrdersHandler(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	select {
-	case <-ctx.Done():
-		logger.Log.Warn("Context canceled or timeout exceeded")
-		return c.Status(fiber.StatusRequestTimeout).JSON(fiber.Map{
-			"error": "Request timed out",
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	orders, err := storage.GetUserOrders(ctx, userID)
+
+	if err != nil {
+		middleware.Logger(c).Error("Error getting user orders", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	if len(orders) == 0 {
+		middleware.Logger(c).Info("No orders found")
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	var response []OrderResponse
+	for _, order := range orders {
+		response = append(response, OrderResponse{
+			Number:     order.OrderNumber,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
 		})
-	default:
-		userID := c.Locals("userID").(uuid.UUID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
 
-		orders, err := storage.GetUserOrders(ctx, userID)
+type OrderResponseV2 struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    Amount    `json:"accrual"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
 
-		if err != nil {
-			logger.Log.Error("Error getting user orders", zap.Error(err))
-			return c.SendStatus(fiber.StatusInternalServerError)
-		}
+func GetOrdersV2Handler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 
-		if len(orders) == 0 {
-			logger.Log.Info("No orders found")
-			return c.SendStatus(fiber.StatusNoContent)
-		}
+	userID := c.Locals("userID").(uuid.UUID)
 
-		var response []OrderResponse
-		for _, order := range orders {
-			response = append(response, OrderResponse{
-				Number:     order.OrderNumber,
-				Status:     order.Status,
-				Accrual:    order.Accrual,
-				UploadedAt: order.UploadedAt,
-			})
-		}
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+
+	orders, total, err := storage.GetUserOrdersPage(ctx, userID, limit, offset)
+	if err != nil {
+		middleware.Logger(c).Error("Error getting user orders", zap.Error(err))
+		return problem.ErrInternal
+	}
 
-		return c.Status(fiber.StatusOK).JSON(response)
+	response := Page[OrderResponseV2]{
+		Items:  make([]OrderResponseV2, 0, len(orders)),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
 	}
+	for _, order := range orders {
+		response.Items = append(response.Items, OrderResponseV2{
+			Number:     order.OrderNumber,
+			Status:     order.Status,
+			Accrual:    Amount(order.Accrual),
+			UploadedAt: order.UploadedAt.UTC(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// OrderDetailResponseV2 — заказ вместе с товарами, переданными при загрузке
+type OrderDetailResponseV2 struct {
+	OrderResponseV2
+	Goods []OrderGood `json:"goods"`
+}
+
+func GetOrderV2Handler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	order, err := storage.GetOrderByNumber(ctx, c.Params("number"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && order.UserID != userID) {
+		return problem.ErrNotFound.WithDetail("Order not found")
+	}
+	if err != nil {
+		middleware.Logger(c).Error("Error getting order", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	items, err := storage.GetOrderItems(ctx, order.ID)
+	if err != nil {
+		middleware.Logger(c).Error("Error getting order items", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	response := OrderDetailResponseV2{
+		OrderResponseV2: OrderResponseV2{
+			Number:     order.OrderNumber,
+			Status:     order.Status,
+			Accrual:    Amount(order.Accrual),
+			UploadedAt: order.UploadedAt.UTC(),
+		},
+		Goods: make([]OrderGood, 0, len(items)),
+	}
+	for _, item := range items {
+		response.Goods = append(response.Goods, OrderGood{
+			Description: item.Description,
+			Price:       Amount(item.Price),
+			Quantity:    item.Quantity,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/hub"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	StreamHeartbeatInterval = 15 * time.Second
+	StreamRetry             = 3 * time.Second
+)
+
+func StreamOrdersHandler(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uuid.UUID)
+
+	var lastEventID uint64
+	if header := c.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			return problem.ErrValidation.WithDetail("Invalid Last-Event-ID header")
+		}
+		lastEventID = id
+	}
+
+	backlog, events, unsubscribe, err := hub.Subscribe(c.UserContext(), userID, lastEventID)
+	if err != nil {
+		middleware.Logger(c).Error("Error loading order stream history", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	log := middleware.Logger(c)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		heartbeat := time.NewTicker(StreamHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		// Событие может прийти и в истории, и в канале: отправленные повторно пропускаются
+		sentID := lastEventID
+
+		fmt.Fprintf(w, "retry: %d\n\n", StreamRetry.Milliseconds())
+		for _, event := range backlog {
+			writeEvent(w, event, log)
+			sentID = event.ID
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// Подписчик не успевал читать события, клиент продолжит с Last-Event-ID
+					log.Warn("Order stream subscriber dropped")
+					return
+				}
+				if event.ID <= sentID {
+					continue
+				}
+				writeEvent(w, event, log)
+				sentID = event.ID
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			if err := w.Flush(); err != nil {
+				log.Info("Order stream client disconnected")
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, event hub.Event, log *zap.Logger) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Error("Error encoding stream event", zap.Error(err))
+		return
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
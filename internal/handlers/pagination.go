@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// Amount — денежная сумма, в API v2 передаётся строкой с двумя знаками после запятой
+type Amount float64
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatFloat(float64(a), 'f', 2, 64))
+}
+
+// UnmarshalJSON принимает как строку, так и число
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+
+	value, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+
+	*a = Amount(value)
+	return nil
+}
+
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+func parsePage(c *fiber.Ctx) (int, int, error) {
+	limit := c.QueryInt("limit", DefaultPageLimit)
+	offset := c.QueryInt("offset", 0)
+
+	if limit <= 0 || limit > MaxPageLimit {
+		return 0, 0, problem.ErrValidation.WithDetail("limit must be between 1 and " + strconv.Itoa(MaxPageLimit))
+	}
+	if offset < 0 {
+		return 0, 0, problem.ErrValidation.WithDetail("offset must not be negative")
+	}
+
+	return limit, offset, nil
+}
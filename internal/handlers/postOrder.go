@@ -1,33 +1,39 @@
 package handlers
 
 import (
-	"bytes"
-	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/sol1corejz/goferrrmart/cmd/config"
-	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
 	"github.com/sol1corejz/goferrrmart/internal/storage"
 	"go.uber.org/zap"
-	"net/http"
+	"math"
 	"regexp"
-	"time"
+	"strconv"
+	"strings"
 )
 
-type Good struct {
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-}
+var luhnCheck = regexp.MustCompile(`^\d+$`)
+
+// MaxOrderGoods ограничивает число позиций в одном заказе
+const MaxOrderGoods = 1000
 
-type Order struct {
-	OrderNumber string `json:"order"`
-	OrderGoods  []Good `json:"goods"`
+// OrderGood — позиция корзины заказа; Price — цена за единицу, Quantity по умолчанию 1
+type OrderGood struct {
+	Description string `json:"description"`
+	Price       Amount `json:"price"`
+	Quantity    int    `json:"quantity"`
 }
 
-var luhnCheck = regexp.MustCompile(`^\d+$`)
+// CreateOrderRequest — тело загрузки заказа в формате JSON. Текстовое тело, как и раньше,
+// содержит только номер заказа
+type CreateOrderRequest struct {
+	Number string      `json:"number"`
+	Goods  []OrderGood `json:"goods"`
+}
 
 func isValidLuhn(order string) bool {
 	var sum int
@@ -50,86 +56,98 @@ func isValidLuhn(order string) bool {
 }
 
 func CreateOrderHandler(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	select {
-	case <-ctx.Done():
-		logger.Log.Warn("Context canceled or timeout exceeded")
-		return c.Status(fiber.StatusRequestTimeout).JSON(fiber.Map{
-			"error": "Request timed out",
-		})
-	default:
-		orderNumber := c.Body()
+	ctx := c.UserContext()
 
-		userID := c.Locals("userID").(uuid.UUID)
+	orderNumber, items, err := parseCreateOrder(c)
+	if err != nil {
+		return err
+	}
 
-		if !luhnCheck.Match(orderNumber) {
-			logger.Log.Error("Invalid order number")
-			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
-				"error": "Invalid order number",
-			})
-		}
+	userID := c.Locals("userID").(uuid.UUID)
 
-		if !isValidLuhn(string(orderNumber)) {
-			logger.Log.Error("Invalid order number")
-			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
-				"error": "Invalid order number",
-			})
-		}
+	if !luhnCheck.Match(orderNumber) {
+		middleware.Logger(c).Error("Invalid order number")
+		return problem.ErrInvalidOrderFormat
+	}
 
-		order, err := storage.GetOrderByNumber(ctx, string(orderNumber))
+	if !isValidLuhn(string(orderNumber)) {
+		middleware.Logger(c).Error("Invalid order number")
+		return problem.ErrInvalidLuhn
+	}
 
-		if err != nil {
-			if !errors.Is(err, sql.ErrNoRows) {
-				logger.Log.Error("Error checking order", zap.Error(err))
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Error checking order",
-				})
-			}
-		}
+	order, err := storage.GetOrderByNumber(ctx, string(orderNumber))
 
-		if order.OrderNumber == string(orderNumber) && order.UserID == userID {
-			logger.Log.Info("Order number already registered by this user")
-			return c.Status(fiber.StatusOK).JSON(fiber.Map{
-				"message": "Order already registered by this user",
-			})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			middleware.Logger(c).Error("Error checking order", zap.Error(err))
+			return problem.ErrInternal
 		}
+	}
 
-		if order.OrderNumber != "" {
-			logger.Log.Info("Order number already exists")
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error": "Order number already exists",
-			})
-		}
+	if order.OrderNumber == string(orderNumber) && order.UserID == userID {
+		middleware.Logger(c).Info("Order number already registered by this user")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Order already registered by this user",
+		})
+	}
 
-		err = storage.CreateOrder(ctx, userID.String(), string(orderNumber))
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error creating order",
-			})
-		}
+	if order.OrderNumber != "" {
+		middleware.Logger(c).Info("Order number already exists")
+		return problem.ErrOrderConflict
+	}
 
-		orderToPost := Order{
-			OrderNumber: string(orderNumber),
-			OrderGoods: []Good{
-				{
-					Description: "Чайник Bork",
-					Price:       7000,
-				},
-			},
-		}
-		jsonData, _ := json.Marshal(orderToPost)
+	// Регистрацию в системе расчёта выполнит фоновый диспетчер: ответ не зависит от её доступности
+	err = storage.CreateOrder(ctx, userID.String(), string(orderNumber), items)
+	if err != nil {
+		return problem.ErrInternal
+	}
 
-		resp, err := http.Post(config.AccrualSystemAddress, "application/json", bytes.NewBuffer(jsonData))
-		defer resp.Body.Close()
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Order created",
+	})
+}
+
+// parseCreateOrder читает номер заказа из текстового тела или номер и товары из JSON
+func parseCreateOrder(c *fiber.Ctx) ([]byte, []models.OrderItem, error) {
+	if !c.Is("json") {
+		return c.Body(), nil, nil
+	}
+
+	var request CreateOrderRequest
+	if err := c.BodyParser(&request); err != nil {
+		return nil, nil, problem.ErrInvalidBody
+	}
 
-		if err != nil {
-			return err
+	if len(request.Goods) > MaxOrderGoods {
+		return nil, nil, problem.ErrValidation.WithDetail("goods must contain at most " + strconv.Itoa(MaxOrderGoods) + " items")
+	}
+
+	items := make([]models.OrderItem, 0, len(request.Goods))
+	for i, good := range request.Goods {
+		field := "goods[" + strconv.Itoa(i) + "]"
+
+		if strings.TrimSpace(good.Description) == "" {
+			return nil, nil, problem.ErrValidation.WithDetail(field + ".description is required")
+		}
+		price := float64(good.Price)
+		if price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+			return nil, nil, problem.ErrValidation.WithDetail(field + ".price must not be negative")
+		}
+		if good.Quantity < 0 {
+			return nil, nil, problem.ErrValidation.WithDetail(field + ".quantity must be positive")
+		}
+
+		quantity := good.Quantity
+		if quantity == 0 {
+			quantity = 1
 		}
 
-		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
-			"message": "Order created",
+		items = append(items, models.OrderItem{
+			Description: good.Description,
+			Price:       price,
+			Quantity:    quantity,
 		})
 	}
+
+	return []byte(request.Number), items, nil
 }
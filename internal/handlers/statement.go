@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	StatementFormatCSV  = "csv"
+	StatementFormatJSON = "json"
+)
+
+// StatementStreamTimeout ограничивает время выгрузки выписки вместе с её транзакцией
+const StatementStreamTimeout = 5 * time.Minute
+
+type StatementEntryResponse struct {
+	Date    time.Time `json:"date"`
+	Type    string    `json:"type"`
+	Order   string    `json:"order"`
+	Amount  float64   `json:"amount"`
+	Balance float64   `json:"balance"`
+}
+
+func GetStatementHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	format := c.Query("format", StatementFormatJSON)
+	if format != StatementFormatCSV && format != StatementFormatJSON {
+		return problem.ErrValidation.WithDetail("format must be csv or json")
+	}
+
+	from, err := parseStatementTime(c.Query("from"), false)
+	if err != nil {
+		return problem.ErrValidation.WithDetail("Invalid from: " + err.Error())
+	}
+	to, err := parseStatementTime(c.Query("to"), true)
+	if err != nil {
+		return problem.ErrValidation.WithDetail("Invalid to: " + err.Error())
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if !from.Before(to) {
+		return problem.ErrValidation.WithDetail("from must be before to")
+	}
+
+	log := middleware.Logger(c)
+
+	// Выписка дописывается после возврата из хендлера: c к этому моменту возвращён в пул,
+	// а контекст запроса отменён, поэтому транзакция открывается на своём контексте
+	streamCtx, streamCancel := context.WithTimeout(context.WithoutCancel(ctx), StatementStreamTimeout)
+
+	statement, err := storage.BeginStatement(streamCtx, userID)
+	if err != nil {
+		streamCancel()
+		log.Error("Error starting statement", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	opening, err := statement.BalanceAt(streamCtx, from)
+	if err != nil {
+		statement.Close()
+		streamCancel()
+		log.Error("Error getting opening balance", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, statementFilename(from, to, format)))
+
+	if format == StatementFormatCSV {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	}
+
+	// Выписка пишется в ответ по мере чтения строк из базы, без буферизации всей истории
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer streamCancel()
+		defer statement.Close()
+
+		var err error
+		if format == StatementFormatCSV {
+			err = writeStatementCSV(streamCtx, w, statement, from, to, opening)
+		} else {
+			err = writeStatementJSON(streamCtx, w, statement, from, to, opening)
+		}
+
+		if err != nil {
+			log.Error("Error streaming statement", zap.Error(err))
+		}
+	})
+
+	return nil
+}
+
+// statementFilename называет файл по первому и последнему дню периода; без from — только по последнему
+func statementFilename(from time.Time, to time.Time, format string) string {
+	last := to.Add(-time.Nanosecond).Format(time.DateOnly)
+	if from.IsZero() {
+		return fmt.Sprintf("statement-until-%s.%s", last, format)
+	}
+
+	return fmt.Sprintf("statement-%s-%s.%s", from.Format(time.DateOnly), last, format)
+}
+
+// parseStatementTime принимает RFC 3339 или дату; дата в качестве конца периода включает весь день
+func parseStatementTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func writeStatementCSV(ctx context.Context, w *bufio.Writer, statement *storage.Statement, from time.Time, to time.Time, opening float64) error {
+	writer := csv.NewWriter(w)
+	balance := opening
+
+	writer.Write([]string{"date", "type", "order", "amount", "balance"})
+	writer.Write([]string{from.Format(time.RFC3339), "opening", "", "", formatMoney(opening)})
+
+	err := statement.Stream(ctx, from, to, func(entry models.StatementEntry) error {
+		balance += entry.Amount
+		writer.Write([]string{
+			entry.Date.UTC().Format(time.RFC3339),
+			entry.Type,
+			entry.OrderNumber,
+			formatMoney(entry.Amount),
+			formatMoney(balance),
+		})
+
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Write([]string{to.Format(time.RFC3339), "closing", "", "", formatMoney(balance)})
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func writeStatementJSON(ctx context.Context, w *bufio.Writer, statement *storage.Statement, from time.Time, to time.Time, opening float64) error {
+	balance := opening
+	first := true
+
+	fmt.Fprintf(w, `{"from":%q,"to":%q,"opening_balance":%s,"entries":[`,
+		from.Format(time.RFC3339), to.Format(time.RFC3339), formatMoney(opening))
+
+	err := statement.Stream(ctx, from, to, func(entry models.StatementEntry) error {
+		balance += entry.Amount
+
+		data, err := json.Marshal(StatementEntryResponse{
+			Date:    entry.Date.UTC(),
+			Type:    entry.Type,
+			Order:   entry.OrderNumber,
+			Amount:  entry.Amount,
+			Balance: balance,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, `],"closing_balance":%s}`, formatMoney(balance))
+	return w.Flush()
+}
+
+func formatMoney(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
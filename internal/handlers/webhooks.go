@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"github.com/sol1corejz/goferrrmart/internal/workers"
+	"go.uber.org/zap"
+	"slices"
+	"time"
+)
+
+const webhookDeliveriesLimit = 100
+
+type WebhookRequest struct {
+	URL        string   `json:"url" validate:"required"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types" validate:"required"`
+}
+
+type WebhookResponse struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID            int        `json:"id"`
+	EventID       int        `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	ResponseCode  *int       `json:"response_code,omitempty"`
+	LastError     *string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+func CreateWebhookHandler(c *fiber.Ctx) error {
+	var request WebhookRequest
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	if err := c.BodyParser(&request); err != nil {
+		return problem.ErrInvalidBody
+	}
+
+	target, err := workers.ValidateWebhookURL(ctx, request.URL)
+	if err != nil {
+		return problem.ErrValidation.WithDetail("Invalid webhook url: " + err.Error())
+	}
+
+	if len(request.EventTypes) == 0 {
+		return problem.ErrValidation.WithDetail("At least one event type is required")
+	}
+	for _, eventType := range request.EventTypes {
+		if !slices.Contains(models.WebhookEventTypes, eventType) {
+			return problem.ErrValidation.WithDetail("Unknown event type: " + eventType)
+		}
+	}
+
+	if request.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			middleware.Logger(c).Error("Error generating webhook secret", zap.Error(err))
+			return problem.ErrInternal
+		}
+		request.Secret = hex.EncodeToString(secret)
+	}
+
+	subscription, err := storage.CreateWebhookSubscription(ctx, models.WebhookSubscription{
+		ID:         uuid.New(),
+		UserID:     userID,
+		URL:        target.String(),
+		Secret:     request.Secret,
+		EventTypes: request.EventTypes,
+	})
+	if err != nil {
+		middleware.Logger(c).Error("Error creating webhook subscription", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	// Секрет возвращается только при создании подписки
+	return c.Status(fiber.StatusCreated).JSON(WebhookResponse{
+		ID:         subscription.ID,
+		URL:        subscription.URL,
+		Secret:     subscription.Secret,
+		EventTypes: subscription.EventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	})
+}
+
+func GetWebhooksHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	subscriptions, err := storage.GetUserWebhookSubscriptions(ctx, userID)
+	if err != nil {
+		middleware.Logger(c).Error("Error getting webhook subscriptions", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	if len(subscriptions) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	var response []WebhookResponse
+	for _, subscription := range subscriptions {
+		response = append(response, WebhookResponse{
+			ID:         subscription.ID,
+			URL:        subscription.URL,
+			EventTypes: subscription.EventTypes,
+			CreatedAt:  subscription.CreatedAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func DeleteWebhookHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.ErrValidation.WithDetail("Invalid webhook id")
+	}
+
+	err = storage.DeleteWebhookSubscription(ctx, userID, subscriptionID)
+	if errors.Is(err, storage.ErrSubscriptionNotFound) {
+		return problem.ErrNotFound.WithDetail("Webhook not found")
+	}
+	if err != nil {
+		middleware.Logger(c).Error("Error deleting webhook subscription", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func GetWebhookDeliveriesHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	subscriptionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return problem.ErrValidation.WithDetail("Invalid webhook id")
+	}
+
+	deliveries, err := storage.GetWebhookDeliveries(ctx, userID, subscriptionID, webhookDeliveriesLimit)
+	if errors.Is(err, storage.ErrSubscriptionNotFound) {
+		return problem.ErrNotFound.WithDetail("Webhook not found")
+	}
+	if err != nil {
+		middleware.Logger(c).Error("Error getting webhook deliveries", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	if len(deliveries) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	var response []WebhookDeliveryResponse
+	for _, delivery := range deliveries {
+		item := WebhookDeliveryResponse{
+			ID:           delivery.ID,
+			EventID:      delivery.EventID,
+			EventType:    delivery.EventType,
+			Status:       delivery.Status,
+			Attempts:     delivery.Attempts,
+			ResponseCode: delivery.ResponseCode,
+			LastError:    delivery.LastError,
+			CreatedAt:    delivery.CreatedAt,
+			DeliveredAt:  delivery.DeliveredAt,
+		}
+		if delivery.Status == models.DeliveryPending {
+			nextAttemptAt := delivery.NextAttemptAt
+			item.NextAttemptAt = &nextAttemptAt
+		}
+		response = append(response, item)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
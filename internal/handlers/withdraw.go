@@ -1,12 +1,17 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/audit"
 	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/middleware"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
 	"github.com/sol1corejz/goferrrmart/internal/storage"
 	"go.uber.org/zap"
+	"math"
 	"time"
 )
 
@@ -17,61 +22,72 @@ type WithdrawRequest struct {
 
 func WithdrawHandler(c *fiber.Ctx) error {
 	var request WithdrawRequest
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	select {
-	case <-ctx.Done():
-		logger.Log.Warn("Context canceled or timeout exceeded")
-		return c.Status(fiber.StatusRequestTimeout).JSON(fiber.Map{
-			"error": "Request timed out",
-		})
-	default:
-		userID := c.Locals("userID").(uuid.UUID)
-
-		if err := c.BodyParser(&request); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
-		}
-
-		balance, err := storage.GetUserBalance(ctx, userID)
-		if err != nil {
-			logger.Log.Error("Error getting user balance", zap.Error(err))
-			return c.SendStatus(fiber.StatusInternalServerError)
-		}
-
-		if balance.CurrentBalance < request.Sum {
-			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
-				"error": "Insufficient funds",
-			})
-		}
-
-		order, err := storage.GetOrderByNumber(ctx, request.Order)
-
-		if order.ID != 0 {
-			logger.Log.Error("Order already exists", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Internal server error",
-			})
-		}
-
-		err = storage.CreateOrder(ctx, userID.String(), request.Order)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error creating order",
-			})
-		}
-
-		err = storage.CreateWithdrawal(ctx, userID, request.Order, request.Sum)
-		if err != nil {
-			logger.Log.Error("Error creating withdrawal", zap.Error(err))
-			return c.SendStatus(fiber.StatusInternalServerError)
-		}
-
-		logger.Log.Info("Withdrawal created successfully", zap.String("userID", userID.String()), zap.String("order", request.Order), zap.Float64("sum", request.Sum))
-		return c.SendStatus(fiber.StatusOK)
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	if err := c.BodyParser(&request); err != nil {
+		return problem.ErrInvalidBody
+	}
+
+	if err := createWithdrawal(c, userID, request.Order, request.Sum); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+type WithdrawRequestV2 struct {
+	Order string `json:"order" validate:"required"`
+	Sum   Amount `json:"sum" validate:"required"`
+}
+
+func WithdrawV2Handler(c *fiber.Ctx) error {
+	var request WithdrawRequestV2
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	if err := c.BodyParser(&request); err != nil {
+		return problem.ErrInvalidBody
+	}
+
+	if err := createWithdrawal(c, userID, request.Order, float64(request.Sum)); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func createWithdrawal(c *fiber.Ctx, userID uuid.UUID, orderNumber string, sum float64) error {
+	ctx := c.UserContext()
+
+	// Без этой проверки отрицательная сумма прошла бы проверку баланса и пополнила его
+	if !(sum > 0) || math.IsInf(sum, 0) {
+		return problem.ErrValidation.WithDetail("sum must be positive")
+	}
+
+	auditEntry, err := audit.Entry(c, models.AuditWithdrawal, userID, "", map[string]interface{}{
+		"order": orderNumber,
+		"sum":   sum,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("Error encoding audit details", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	err = storage.CreateWithdrawal(ctx, userID, orderNumber, sum, auditEntry)
+	if errors.Is(err, storage.ErrInsufficientFunds) {
+		return problem.ErrInsufficientFunds
+	}
+	if errors.Is(err, storage.ErrOrderExists) {
+		return problem.ErrOrderExists
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Error creating withdrawal", zap.Error(err))
+		return problem.ErrInternal
 	}
+
+	logger.FromContext(ctx).Info("Withdrawal created successfully", zap.String("userID", userID.String()), zap.String("order", orderNumber), zap.Float64("sum", sum))
+	return nil
 }
 
 type WithdrawalsResponse struct {
@@ -81,39 +97,69 @@ type WithdrawalsResponse struct {
 }
 
 func GetWithdrawalsHandler(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-
-	select {
-	case <-ctx.Done():
-		logger.Log.Warn("Context canceled or timeout exceeded")
-		return c.Status(fiber.StatusRequestTimeout).JSON(fiber.Map{
-			"error": "Request timed out",
+	ctx := c.UserContext()
+
+	userID := c.Locals("userID").(uuid.UUID)
+
+	withdrawals, err := storage.GetUserWithdrawals(ctx, userID)
+
+	if err != nil {
+		middleware.Logger(c).Error("Error getting user withdrawals", zap.Error(err))
+		return problem.ErrInternal
+	}
+
+	if len(withdrawals) == 0 {
+		middleware.Logger(c).Info("No withdrawals found")
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	var response []WithdrawalsResponse
+	for _, withdrawal := range withdrawals {
+		response = append(response, WithdrawalsResponse{
+			Order:       withdrawal.OrderNumber,
+			Sum:         withdrawal.Sum,
+			ProcessedAt: withdrawal.ProcessedAt,
 		})
-	default:
-		userID := c.Locals("userID").(uuid.UUID)
+	}
 
-		withdrawals, err := storage.GetUserWithdrawals(ctx, userID)
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+type WithdrawalsResponseV2 struct {
+	Order       string    `json:"order"`
+	Sum         Amount    `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
 
-		if err != nil {
-			logger.Log.Error("Error getting user withdrawals", zap.Error(err))
-			return c.SendStatus(fiber.StatusInternalServerError)
-		}
+func GetWithdrawalsV2Handler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
 
-		if len(withdrawals) == 0 {
-			logger.Log.Info("No withdrawals found")
-			return c.SendStatus(fiber.StatusNoContent)
-		}
+	userID := c.Locals("userID").(uuid.UUID)
 
-		var response []WithdrawalsResponse
-		for _, withdrawal := range withdrawals {
-			response = append(response, WithdrawalsResponse{
-				Order:       withdrawal.OrderNumber,
-				Sum:         withdrawal.Sum,
-				ProcessedAt: withdrawal.ProcessedAt,
-			})
-		}
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
 
-		return c.Status(fiber.StatusOK).JSON(response)
+	withdrawals, total, err := storage.GetUserWithdrawalsPage(ctx, userID, limit, offset)
+	if err != nil {
+		middleware.Logger(c).Error("Error getting user withdrawals", zap.Error(err))
+		return problem.ErrInternal
 	}
+
+	response := Page[WithdrawalsResponseV2]{
+		Items:  make([]WithdrawalsResponseV2, 0, len(withdrawals)),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	}
+	for _, withdrawal := range withdrawals {
+		response.Items = append(response.Items, WithdrawalsResponseV2{
+			Order:       withdrawal.OrderNumber,
+			Sum:         Amount(withdrawal.Sum),
+			ProcessedAt: withdrawal.ProcessedAt.UTC(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
 }
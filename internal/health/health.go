@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/cmd/config"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+	// StatusDegraded — не прошла необязательная проверка: сервис работает и остаётся в ротации
+	StatusDegraded = "degraded"
+)
+
+const CheckTimeout = 2 * time.Second
+
+type Check struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// State — дополнительное состояние проверки, например автоматического выключателя
+	State string `json:"state,omitempty"`
+}
+
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+var draining atomic.Bool
+
+// readinessChecks — проверки /readyz по именам; переменная, чтобы тесты могли подменить проверки базы
+var readinessChecks = map[string]func(context.Context) error{
+	"database":   storage.Ping,
+	"migrations": storage.CheckMigrations,
+	"accrual":    checkAccrual,
+}
+
+// optionalChecks не влияют на готовность. Заказы принимаются и без системы расчёта: регистрация
+// идёт через outbox, поэтому снимать реплики с балансировки из-за неё нельзя
+var optionalChecks = map[string]bool{
+	"accrual": true,
+}
+
+var errAccrualNotConfigured = errors.New("accrual system address is not configured")
+
+// SetDraining переводит сервис в состояние not ready на время остановки
+func SetDraining() {
+	draining.Store(true)
+}
+
+func LivenessHandler(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(Report{Status: StatusOK})
+}
+
+func ReadinessHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), CheckTimeout)
+	defer cancel()
+
+	checks := readinessChecks
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Check, len(checks)+1),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+			result := run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+		}(name, check)
+	}
+	wg.Wait()
+
+	// Состояние выключателя только попадает в отчёт: разомкнутая цепь делает проверку degraded,
+	// но на готовность не влияет
+	if breaker, ok := accrual.Default.(interface{ State() accrual.BreakerState }); ok {
+		check := report.Checks["accrual"]
+		state := breaker.State()
+		check.State = state.String()
+		if state != accrual.BreakerClosed && check.Status == StatusOK {
+			check.Status = StatusDegraded
+		}
+		report.Checks["accrual"] = check
+	}
+
+	if draining.Load() {
+		report.Checks["shutdown"] = Check{Status: StatusFail, Error: "server is shutting down"}
+	}
+
+	for name, check := range report.Checks {
+		if check.Status == StatusOK {
+			continue
+		}
+		if optionalChecks[name] {
+			check.Status = StatusDegraded
+			report.Checks[name] = check
+			if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+			continue
+		}
+		report.Status = StatusFail
+	}
+
+	if report.Status == StatusFail {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+	}
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+func run(ctx context.Context, check func(context.Context) error) Check {
+	start := time.Now()
+	err := check(ctx)
+
+	result := Check{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkAccrual считает систему расчёта доступной, если она отвечает без 5xx. Проверка идёт
+// мимо выключателя: иначе пробы считались бы его отказами и занимали пробные запросы half-open
+func checkAccrual(ctx context.Context) error {
+	if config.Current.AccrualSystemAddress == "" {
+		return errAccrualNotConfigured
+	}
+
+	client := accrual.Default
+	if wrapper, ok := client.(interface{ Unwrap() accrual.Client }); ok {
+		client = wrapper.Unwrap()
+	}
+	return client.Ping(ctx)
+}
@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/cmd/config"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCheckAccrualBypassesBreaker — неудачные пробы готовности не размыкают цепь
+func TestCheckAccrualBypassesBreaker(t *testing.T) {
+	defaultClient, address := accrual.Default, config.Current.AccrualSystemAddress
+	defer func() {
+		accrual.Default, config.Current.AccrualSystemAddress = defaultClient, address
+	}()
+
+	fake := accrual.NewFake()
+	fake.PingErr = &accrual.StatusError{Code: http.StatusServiceUnavailable}
+	breaker := accrual.NewBreaker(fake, accrual.BreakerOptions{Failures: 1})
+	accrual.Default = breaker
+	config.Current.AccrualSystemAddress = "http://accrual"
+
+	for i := 0; i < 3; i++ {
+		var statusErr *accrual.StatusError
+		if err := checkAccrual(context.Background()); !errors.As(err, &statusErr) {
+			t.Fatalf("checkAccrual = %v, want status error", err)
+		}
+	}
+	if state := breaker.State(); state != accrual.BreakerClosed {
+		t.Fatalf("breaker state = %s, want closed", state)
+	}
+}
+
+// TestReadinessWithOpenCircuit — недоступная система расчёта и разомкнутая цепь не снимают
+// реплику с балансировки, а только отражаются в отчёте
+func TestReadinessWithOpenCircuit(t *testing.T) {
+	defaultClient, address, checks := accrual.Default, config.Current.AccrualSystemAddress, readinessChecks
+	defer func() {
+		accrual.Default, config.Current.AccrualSystemAddress, readinessChecks = defaultClient, address, checks
+	}()
+
+	readinessChecks = map[string]func(context.Context) error{
+		"database":   func(context.Context) error { return nil },
+		"migrations": func(context.Context) error { return nil },
+		"accrual":    checkAccrual,
+	}
+
+	fake := accrual.NewFake()
+	fake.PingErr = &accrual.StatusError{Code: http.StatusServiceUnavailable}
+	fake.SetError("1", &accrual.StatusError{Code: http.StatusServiceUnavailable})
+	breaker := accrual.NewBreaker(fake, accrual.BreakerOptions{Failures: 1})
+	breaker.GetOrder(context.Background(), "1")
+	accrual.Default = breaker
+	config.Current.AccrualSystemAddress = "http://accrual"
+
+	app := fiber.New()
+	app.Get("/readyz", ReadinessHandler)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/readyz", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var report Report
+	if err = json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != StatusDegraded {
+		t.Fatalf("report status = %q, want %q", report.Status, StatusDegraded)
+	}
+	check := report.Checks["accrual"]
+	if check.Status != StatusDegraded || check.State != accrual.BreakerOpen.String() {
+		t.Fatalf("accrual check = %+v, want degraded with open circuit", check)
+	}
+}
@@ -0,0 +1,250 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	EventOrder   = "order"
+	EventBalance = "balance"
+)
+
+// HistorySize — сколько последних событий отдаётся при возобновлении по Last-Event-ID
+const HistorySize = 100
+
+const (
+	// Retention — сколько события хранятся в БД для возобновления потока
+	Retention     = 24 * time.Hour
+	PruneInterval = time.Hour
+	ListenRetry   = 5 * time.Second
+	QueryTimeout  = 5 * time.Second
+)
+
+const subscriberBuffer = 16
+
+type Event struct {
+	ID     uint64
+	Type   string
+	UserID uuid.UUID
+	Data   interface{}
+}
+
+type OrderEvent struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    float64   `json:"accrual,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type BalanceEvent struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+// Hub раздаёт события подписчикам своего экземпляра. События сохраняются в БД и приходят
+// через LISTEN/NOTIFY, поэтому событие, опубликованное на любом экземпляре, доходит до всех
+type Hub struct {
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[uuid.UUID]map[chan Event]struct{}
+}
+
+var Default = New()
+
+func New() *Hub {
+	return &Hub{
+		subscribers: make(map[uuid.UUID]map[chan Event]struct{}),
+	}
+}
+
+func Publish(ctx context.Context, userID uuid.UUID, eventType string, data interface{}) (Event, error) {
+	return Default.Publish(ctx, userID, eventType, data)
+}
+
+func Subscribe(ctx context.Context, userID uuid.UUID, lastEventID uint64) ([]Event, <-chan Event, func(), error) {
+	return Default.Subscribe(ctx, userID, lastEventID)
+}
+
+// Publish сохраняет событие. Подписчикам оно раздаётся из Run, когда придёт уведомление,
+// в том числе на этом же экземпляре
+func (h *Hub) Publish(ctx context.Context, userID uuid.UUID, eventType string, data interface{}) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	stored, err := storage.InsertStreamEvent(ctx, userID, eventType, payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return fromStored(stored), nil
+}
+
+// Subscribe возвращает сохранённые события с ID больше lastEventID и канал для новых событий.
+// Канал регистрируется до чтения истории, поэтому событие может прийти и в истории, и в канале —
+// повторы с ID не больше последнего отправленного нужно пропускать.
+// Возвращаемую функцию нужно вызвать, когда подписка больше не нужна.
+func (h *Hub) Subscribe(ctx context.Context, userID uuid.UUID, lastEventID uint64) ([]Event, <-chan Event, func(), error) {
+	ch, unsubscribe := h.subscribe(userID)
+
+	if lastEventID == 0 {
+		return nil, ch, unsubscribe, nil
+	}
+
+	stored, err := storage.GetStreamEvents(ctx, userID, int64(lastEventID), HistorySize)
+	if err != nil {
+		unsubscribe()
+		return nil, nil, nil, err
+	}
+
+	backlog := make([]Event, 0, len(stored))
+	for _, event := range stored {
+		backlog = append(backlog, fromStored(event))
+	}
+
+	return backlog, ch, unsubscribe, nil
+}
+
+func (h *Hub) subscribe(userID uuid.UUID) (chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if _, ok := h.subscribers[userID][ch]; ok {
+				delete(h.subscribers[userID], ch)
+				close(ch)
+			}
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// deliver отправляет событие подписчикам пользователя на этом экземпляре
+func (h *Hub) deliver(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			// Медленный подписчик отключается, клиент переподключится с Last-Event-ID
+			delete(h.subscribers[event.UserID], ch)
+			close(ch)
+		}
+	}
+	if len(h.subscribers[event.UserID]) == 0 {
+		delete(h.subscribers, event.UserID)
+	}
+}
+
+// receive разбирает уведомление из StreamEventsChannel и раздаёт событие
+func (h *Hub) receive(payload string) {
+	var stored models.StreamEvent
+	if err := json.Unmarshal([]byte(payload), &stored); err != nil {
+		logger.Log.Error("Invalid stream event notification", zap.Error(err))
+		return
+	}
+
+	h.deliver(fromStored(stored))
+}
+
+// Run слушает StreamEventsChannel и раздаёт события подписчикам, пока не отменён ctx.
+// При обрыве подписки переподключается; пропущенные за это время события клиенты
+// получат из БД, переподключившись с Last-Event-ID
+func (h *Hub) Run(ctx context.Context) {
+	go h.prune(ctx)
+
+	for {
+		err := storage.ListenStreamEvents(ctx, func() {
+			logger.Log.Info("Listening for stream events")
+		}, h.receive)
+
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log.Warn("Stream events subscription lost", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ListenRetry):
+		}
+	}
+}
+
+// prune раз в PruneInterval удаляет события старше Retention
+func (h *Hub) prune(ctx context.Context) {
+	ticker := time.NewTicker(PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruneCtx, cancel := context.WithTimeout(ctx, QueryTimeout)
+			pruned, err := storage.PruneStreamEvents(pruneCtx, Retention)
+			cancel()
+
+			if err != nil {
+				logger.Log.Error("Error pruning stream events", zap.Error(err))
+				continue
+			}
+			if pruned > 0 {
+				logger.Log.Info("Stream events pruned", zap.Int64("events", pruned))
+			}
+		}
+	}
+}
+
+// Close отключает всех подписчиков, чтобы потоковые ответы завершились при остановке сервера
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for userID, subscribers := range h.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(h.subscribers, userID)
+	}
+}
+
+func fromStored(event models.StreamEvent) Event {
+	return Event{
+		ID:     uint64(event.ID),
+		Type:   event.Type,
+		UserID: event.UserID,
+		Data:   event.Payload,
+	}
+}
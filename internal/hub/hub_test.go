@@ -0,0 +1,58 @@
+package hub
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+// TestReceiveDeliversToUserSubscribers проверяет, что уведомление из БД доходит только до
+// подписчиков своего пользователя, а после отписки последнего пользователь не хранится
+func TestReceiveDeliversToUserSubscribers(t *testing.T) {
+	h := New()
+	userID, otherID := uuid.New(), uuid.New()
+
+	events, unsubscribe := h.subscribe(userID)
+	other, unsubscribeOther := h.subscribe(otherID)
+	defer unsubscribeOther()
+
+	h.receive(`{"id":42,"user_id":"` + userID.String() + `","type":"order","data":{"number":"1","status":"PROCESSED"}}`)
+
+	event := <-events
+	if event.ID != 42 || event.Type != EventOrder || event.UserID != userID {
+		t.Fatalf("event = %+v, want order event 42 for user", event)
+	}
+	select {
+	case event := <-other:
+		t.Fatalf("other user got %+v", event)
+	default:
+	}
+
+	unsubscribe()
+	if _, ok := h.subscribers[userID]; ok {
+		t.Fatal("user is kept after the last subscriber left")
+	}
+}
+
+// TestDeliverDropsSlowSubscriber — подписчик с переполненным буфером отключается
+func TestDeliverDropsSlowSubscriber(t *testing.T) {
+	h := New()
+	userID := uuid.New()
+
+	events, unsubscribe := h.subscribe(userID)
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		h.deliver(Event{ID: uint64(i + 1), Type: EventBalance, UserID: userID})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Fatalf("received %d events before drop, want %d", received, subscriberBuffer)
+	}
+	if _, ok := h.subscribers[userID]; ok {
+		t.Fatal("dropped subscriber is still registered")
+	}
+}
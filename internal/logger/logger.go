@@ -1,21 +1,55 @@
 package logger
 
 import (
+	"context"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-var Log = zap.NewNop()
+// Level — общий уровень всех логгеров, меняется на лету через админку и SIGHUP
+var Level = zap.NewAtomicLevel()
 
-func Initialize(level string) error {
+var (
+	Log = zap.NewNop()
 
-	lvl, err := zap.ParseAtomicLevel(level)
+	// Логгеры компонентов: отличаются полем "logger" в записи
+	HTTP    = Log
+	Storage = Log
+	Worker  = Log
+	Auth    = Log
+)
+
+// configuredLevel — уровень из конфигурации, к которому возвращает ToggleDebug
+var configuredLevel = zapcore.InfoLevel
+
+// Sampling — параметры сэмплирования одинаковых сообщений: в каждую секунду пишутся первые
+// Initial записей, затем каждая Thereafter-я. Initial = 0 отключает сэмплирование
+type Sampling struct {
+	Initial    int
+	Thereafter int
+}
+
+func Initialize(level string, sampling Sampling) error {
+
+	lvl, err := zapcore.ParseLevel(level)
 	if err != nil {
 		return err
 	}
 
+	configuredLevel = lvl
+	Level.SetLevel(lvl)
+
 	cfg := zap.NewProductionConfig()
 
-	cfg.Level = lvl
+	cfg.Level = Level
+
+	cfg.Sampling = nil
+	if sampling.Initial > 0 {
+		cfg.Sampling = &zap.SamplingConfig{
+			Initial:    sampling.Initial,
+			Thereafter: sampling.Thereafter,
+		}
+	}
 
 	zl, err := cfg.Build()
 	if err != nil {
@@ -23,5 +57,34 @@ func Initialize(level string) error {
 	}
 
 	Log = zl
+	HTTP = zl.Named("http")
+	Storage = zl.Named("storage")
+	Worker = zl.Named("worker")
+	Auth = zl.Named("auth")
 	return nil
 }
+
+// ToggleDebug переключает уровень между debug и заданным в конфигурации и возвращает новый уровень
+func ToggleDebug() zapcore.Level {
+	if Level.Level() == zapcore.DebugLevel && configuredLevel != zapcore.DebugLevel {
+		Level.SetLevel(configuredLevel)
+	} else {
+		Level.SetLevel(zapcore.DebugLevel)
+	}
+	return Level.Level()
+}
+
+type ctxKey struct{}
+
+// NewContext сохраняет логгер запроса в контексте
+func NewContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext возвращает логгер запроса, а если его нет — глобальный Log
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return Log
+}
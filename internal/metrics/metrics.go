@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"strconv"
+	"time"
+)
+
+const namespace = "gophermart"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	WorkerPendingOrders = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "pending_orders",
+		Help:      "Number of orders awaiting a final accrual status on the last poll.",
+	})
+
+	WorkerPollDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "poll_duration_seconds",
+		Help:      "Duration of a loyalty worker poll cycle.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	AccrualResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "responses_total",
+		Help:      "Accrual system responses by HTTP status code, \"error\" for transport failures.",
+	}, []string{"code"})
+
+	AccrualCircuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "circuit_state",
+		Help:      "Accrual circuit breaker state: 0 closed, 1 half-open, 2 open.",
+	})
+
+	AccrualCircuitTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "circuit_transitions_total",
+		Help:      "Accrual circuit breaker state changes by target state.",
+	}, []string{"state"})
+
+	AccrualPendingRegistrations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "pending_registrations",
+		Help:      "Orders waiting to be registered in the accrual system.",
+	})
+
+	OrderTimeToProcessed = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "worker",
+		Name:      "order_time_to_processed_seconds",
+		Help:      "Time from order upload to the PROCESSED status.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600, 4 * 3600, 24 * 3600},
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		WorkerPendingOrders,
+		WorkerPollDuration,
+		AccrualResponses,
+		AccrualCircuitState,
+		AccrualCircuitTransitions,
+		AccrualPendingRegistrations,
+		OrderTimeToProcessed,
+	)
+}
+
+// RegisterDB добавляет статистику пула соединений sql.DB
+func RegisterDB(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Middleware считает запросы и их длительность по шаблону маршрута Fiber
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	route := c.Route().Path
+	labels := prometheus.Labels{
+		"method": c.Method(),
+		"route":  route,
+		"status": strconv.Itoa(c.Response().StatusCode()),
+	}
+
+	HTTPRequests.With(labels).Inc()
+	HTTPDuration.With(labels).Observe(time.Since(start).Seconds())
+
+	return nil
+}
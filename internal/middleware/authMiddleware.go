@@ -3,27 +3,26 @@ package middleware
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/sol1corejz/goferrrmart/internal/auth"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"go.uber.org/zap"
 )
 
 func AuthMiddleware(c *fiber.Ctx) error {
 	// Получение токена из cookies
 	tokenString := c.Cookies("jwt")
 	if tokenString == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Unauthorized",
-		})
+		return problem.ErrUnauthorized
 	}
 
 	// Проверка токена и извлечение UserID
 	userID, err := auth.GetUserID(tokenString)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid or expired token",
-		})
+		return problem.ErrInvalidToken
 	}
 
 	// Сохранение userID в контексте для использования в последующих обработчиках
 	c.Locals("userID", userID)
+	setRequestLogger(c, requestLogger(c).With(zap.String("userID", userID.String())))
 
 	return c.Next()
 }
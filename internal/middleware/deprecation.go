@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type DeprecationConfig struct {
+	// DeprecatedAt — дата объявления версии устаревшей (заголовок Deprecation, RFC 9745),
+	// нулевое значение не выставляется
+	DeprecatedAt time.Time
+	// Sunset — дата отключения версии (заголовок Sunset, RFC 8594), нулевое значение не выставляется
+	Sunset time.Time
+	// Prefix и SuccessorPrefix используются для ссылки на тот же ресурс в новой версии
+	Prefix          string
+	SuccessorPrefix string
+}
+
+func Deprecation(cfg DeprecationConfig) fiber.Handler {
+	deprecation := fmt.Sprintf("@%d", cfg.DeprecatedAt.Unix())
+
+	return func(c *fiber.Ctx) error {
+		if !cfg.DeprecatedAt.IsZero() {
+			c.Set("Deprecation", deprecation)
+		}
+
+		if !cfg.Sunset.IsZero() {
+			c.Set("Sunset", cfg.Sunset.UTC().Format(http.TimeFormat))
+		}
+
+		if cfg.SuccessorPrefix != "" && strings.HasPrefix(c.Path(), cfg.Prefix) {
+			successor := cfg.SuccessorPrefix + strings.TrimPrefix(c.Path(), cfg.Prefix)
+			c.Append(fiber.HeaderLink, fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		}
+
+		return c.Next()
+	}
+}
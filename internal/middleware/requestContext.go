@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"go.uber.org/zap"
+	"time"
+)
+
+type TimeoutConfig struct {
+	// Default — таймаут обработки запроса, 0 отключает ограничение
+	Default time.Duration
+	// Routes переопределяет таймаут для конкретных путей (например, потоковых ответов)
+	Routes map[string]time.Duration
+}
+
+// RequestContext кладёт в UserContext контекст запроса с таймаутом, который отменяется
+// при остановке сервера. fasthttp не сообщает об обрыве соединения клиентом, поэтому
+// потоковые обработчики дополнительно прекращают работу при ошибке записи
+func RequestContext(cfg TimeoutConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		timeout := cfg.Default
+		if routeTimeout, ok := cfg.Routes[c.Path()]; ok {
+			timeout = routeTimeout
+		}
+
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(c.UserContext(), timeout)
+		} else {
+			ctx, cancel = context.WithCancel(c.UserContext())
+		}
+		defer cancel()
+
+		// RequestCtx.Done закрывается при остановке fasthttp-сервера
+		stop := context.AfterFunc(c.Context(), cancel)
+		defer stop()
+
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			Logger(c).Warn("Request timed out", zap.Duration("timeout", timeout))
+			return problem.ErrRequestTimeout
+		case errors.Is(ctx.Err(), context.Canceled) && err != nil:
+			return problem.ErrServiceUnavailable
+		}
+
+		return err
+	}
+}
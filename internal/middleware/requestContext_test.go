@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRequestContextStatus проверяет, что ответы о таймауте и отмене запроса отрисовываются
+// до внешних слоёв и те видят тот же статус, что и клиент
+func TestRequestContextStatus(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		parent     context.Context
+		handler    fiber.Handler
+		wantStatus int
+	}{
+		{
+			name:   "timeout",
+			parent: context.Background(),
+			handler: func(c *fiber.Ctx) error {
+				<-c.UserContext().Done()
+				return c.UserContext().Err()
+			},
+			wantStatus: fiber.StatusRequestTimeout,
+		},
+		{
+			name:   "server shutdown",
+			parent: canceled,
+			handler: func(c *fiber.Ctx) error {
+				return c.UserContext().Err()
+			},
+			wantStatus: fiber.StatusServiceUnavailable,
+		},
+		{
+			name:   "handler error",
+			parent: context.Background(),
+			handler: func(c *fiber.Ctx) error {
+				return problem.ErrNotFound
+			},
+			wantStatus: fiber.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var observed int
+
+			app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+			app.Use(func(c *fiber.Ctx) error {
+				c.SetUserContext(tt.parent)
+				if err := c.Next(); err != nil {
+					return err
+				}
+				observed = c.Response().StatusCode()
+				return nil
+			})
+			app.Use(problem.Middleware)
+			app.Use(RequestContext(TimeoutConfig{Default: 20 * time.Millisecond}))
+			app.Get("/", tt.handler)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if observed != tt.wantStatus {
+				t.Fatalf("outer middleware observed %d, want %d", observed, tt.wantStatus)
+			}
+		})
+	}
+}
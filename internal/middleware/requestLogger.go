@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"regexp"
+	"time"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestLogger назначает X-Request-ID, кладёт логгер запроса в контекст
+// и пишет одну строку access-лога на каждый запрос
+func RequestLogger(c *fiber.Ctx) error {
+	start := time.Now()
+
+	requestID := c.Get(HeaderRequestID)
+	if !validRequestID.MatchString(requestID) {
+		requestID = uuid.NewString()
+	}
+	c.Set(HeaderRequestID, requestID)
+	c.Locals("requestID", requestID)
+
+	fields := []zap.Field{zap.String("requestID", requestID)}
+	if spanContext := trace.SpanContextFromContext(c.UserContext()); spanContext.HasTraceID() {
+		fields = append(fields, zap.String("traceID", spanContext.TraceID().String()))
+	}
+	setRequestLogger(c, logger.HTTP.With(fields...))
+
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	accessFields := []zap.Field{
+		zap.String("method", c.Method()),
+		zap.String("path", c.Path()),
+		zap.String("route", c.Route().Path),
+		zap.Int("status", status),
+		zap.Duration("latency", time.Since(start)),
+		zap.Int("bytesIn", len(c.Request().Body())),
+		zap.String("ip", c.IP()),
+		zap.String("userAgent", c.Get(fiber.HeaderUserAgent)),
+	}
+	// Тело потокового ответа (SSE, выписки) ещё не отправлено, читать его здесь нельзя
+	if c.Response().IsBodyStream() {
+		accessFields = append(accessFields, zap.Bool("stream", true))
+	} else {
+		accessFields = append(accessFields, zap.Int("bytesOut", len(c.Response().Body())))
+	}
+	if err := problem.RenderedError(c); err != nil {
+		accessFields = append(accessFields, zap.Error(err))
+	}
+
+	accessLog := requestLogger(c)
+	if status >= fiber.StatusInternalServerError {
+		accessLog.Error("Request completed", accessFields...)
+	} else {
+		accessLog.Info("Request completed", accessFields...)
+	}
+
+	return nil
+}
+
+// Logger возвращает логгер текущего запроса с requestID, userID и маршрутом
+func Logger(c *fiber.Ctx) *zap.Logger {
+	return requestLogger(c).With(zap.String("route", c.Route().Path))
+}
+
+func requestLogger(c *fiber.Ctx) *zap.Logger {
+	if l, ok := c.Locals("logger").(*zap.Logger); ok {
+		return l
+	}
+	return logger.HTTP
+}
+
+func setRequestLogger(c *fiber.Ctx, l *zap.Logger) {
+	c.Locals("logger", l)
+	c.SetUserContext(logger.NewContext(c.UserContext(), l))
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"github.com/google/uuid"
 	"time"
 )
@@ -27,6 +28,24 @@ type Order struct {
 	Status      string    `db:"status"`
 	Accrual     float64   `db:"accrual"`
 	UploadedAt  time.Time `db:"uploaded_at"`
+	Attempts    int       `db:"attempts"`
+	NextCheckAt time.Time `db:"next_check_at"`
+}
+
+// OrderItem — товар из корзины заказа; Price — цена за единицу
+type OrderItem struct {
+	ID          int     `db:"id"`
+	OrderID     int     `db:"order_id"`
+	Description string  `db:"description"`
+	Price       float64 `db:"price"`
+	Quantity    int     `db:"quantity"`
+}
+
+// AccrualRegistration — запись outbox регистрации заказа в системе расчёта
+type AccrualRegistration struct {
+	OrderID     int    `db:"order_id"`
+	OrderNumber string `db:"order_number"`
+	Attempts    int    `db:"attempts"`
 }
 
 type UserBalance struct {
@@ -43,3 +62,100 @@ type Withdrawal struct {
 	Sum         float64   `db:"sum"`
 	ProcessedAt time.Time `db:"processed_at"`
 }
+
+const (
+	EventOrderProcessed    = "order.processed"
+	EventOrderInvalid      = "order.invalid"
+	EventWithdrawalCreated = "withdrawal.created"
+)
+
+var WebhookEventTypes = []string{EventOrderProcessed, EventOrderInvalid, EventWithdrawalCreated}
+
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryDead      = "DEAD"
+)
+
+type OutboxEvent struct {
+	ID           int        `db:"id"`
+	UserID       uuid.UUID  `db:"user_id"`
+	EventType    string     `db:"event_type"`
+	Payload      []byte     `db:"payload"`
+	CreatedAt    time.Time  `db:"created_at"`
+	DispatchedAt *time.Time `db:"dispatched_at"`
+}
+
+// StreamEvent — сохранённое событие потока заказов; в таком виде оно приходит и в уведомлении
+type StreamEvent struct {
+	ID        int64           `db:"id" json:"id"`
+	UserID    uuid.UUID       `db:"user_id" json:"user_id"`
+	Type      string          `db:"event_type" json:"type"`
+	Payload   json.RawMessage `db:"payload" json:"data"`
+	CreatedAt time.Time       `db:"created_at" json:"-"`
+}
+
+type WebhookSubscription struct {
+	ID         uuid.UUID `db:"id"`
+	UserID     uuid.UUID `db:"user_id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	EventTypes []string  `db:"event_types"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int        `db:"id"`
+	SubscriptionID uuid.UUID  `db:"subscription_id"`
+	EventID        int        `db:"event_id"`
+	EventType      string     `db:"event_type"`
+	Payload        []byte     `db:"payload"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	ResponseCode   *int       `db:"response_code"`
+	LastError      *string    `db:"last_error"`
+	CreatedAt      time.Time  `db:"created_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	URL            string     `db:"url"`
+	Secret         string     `db:"secret"`
+}
+
+const (
+	StatementAccrual    = "accrual"
+	StatementWithdrawal = "withdrawal"
+)
+
+type StatementEntry struct {
+	Date        time.Time `db:"date"`
+	Type        string    `db:"type"`
+	OrderNumber string    `db:"order_number"`
+	Amount      float64   `db:"amount"`
+}
+
+const (
+	AuditRegistration = "user.registered"
+	AuditLogin        = "user.login"
+	AuditLoginFailed  = "user.login_failed"
+	AuditWithdrawal   = "withdrawal.created"
+)
+
+type AuditEntry struct {
+	ID         int64           `db:"id" json:"id"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	Action     string          `db:"action" json:"action"`
+	ActorID    *uuid.UUID      `db:"actor_id" json:"actor_id,omitempty"`
+	ActorLogin string          `db:"actor_login" json:"actor_login,omitempty"`
+	IP         string          `db:"ip" json:"ip"`
+	UserAgent  string          `db:"user_agent" json:"user_agent"`
+	RequestID  string          `db:"request_id" json:"request_id"`
+	Details    json.RawMessage `db:"details" json:"details,omitempty"`
+}
+
+type AuditFilter struct {
+	ActorID *uuid.UUID
+	Action  string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
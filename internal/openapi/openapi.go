@@ -0,0 +1,77 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// swaggerUI — файлы swagger-ui-dist, встроенные в бинарник: документация не зависит от CDN
+//
+//go:embed swagger-ui
+var swaggerUI embed.FS
+
+var pathParam = regexp.MustCompile(`:(\w+)\??`)
+
+func SpecHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(Spec)
+}
+
+func DocsHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(swaggerPage)
+}
+
+// AssetsHandler отдаёт встроенные файлы Swagger UI
+func AssetsHandler(c *fiber.Ctx) error {
+	name := c.Params("file")
+	if !fs.ValidPath(name) || strings.Contains(name, "/") {
+		return fiber.ErrNotFound
+	}
+
+	data, err := swaggerUI.ReadFile(path.Join("swagger-ui", name))
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+
+	c.Type(path.Ext(name))
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return c.Send(data)
+}
+
+// MissingRoutes возвращает зарегистрированные в Fiber маршруты, которых нет в спецификации
+func MissingRoutes(routes []fiber.Route) ([]string, error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(Spec, &spec); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, route := range routes {
+		if route.Method == fiber.MethodHead || route.Method == fiber.MethodOptions {
+			continue
+		}
+
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		if _, ok := spec.Paths[path][strings.ToLower(route.Method)]; !ok {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	sort.Strings(missing)
+	return missing, nil
+}
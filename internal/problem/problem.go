@@ -0,0 +1,136 @@
+package problem
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+const ContentType = "application/problem+json"
+
+const typePrefix = "urn:gophermart:problem:"
+
+const errorKey = "error"
+
+// Problem — ошибка в формате RFC 7807, Code — стабильный машиночитаемый код для клиентов
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+func New(status int, code string, title string) *Problem {
+	return &Problem{
+		Type:   typePrefix + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Code + ": " + p.Detail
+	}
+	return p.Code
+}
+
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Code == p.Code
+}
+
+func (p *Problem) WithDetail(detail string) *Problem {
+	clone := *p
+	clone.Detail = detail
+	return &clone
+}
+
+var (
+	ErrInvalidBody        = New(fiber.StatusBadRequest, "invalid_request_body", "Invalid request body")
+	ErrValidation         = New(fiber.StatusBadRequest, "validation_failed", "Request validation failed")
+	ErrUnauthorized       = New(fiber.StatusUnauthorized, "unauthorized", "Authentication required")
+	ErrInvalidToken       = New(fiber.StatusUnauthorized, "invalid_token", "Invalid or expired token")
+	ErrWrongCredentials   = New(fiber.StatusUnauthorized, "invalid_credentials", "Wrong login or password")
+	ErrInsufficientFunds  = New(fiber.StatusPaymentRequired, "insufficient_funds", "Insufficient funds")
+	ErrNotFound           = New(fiber.StatusNotFound, "not_found", "Resource not found")
+	ErrRequestTimeout     = New(fiber.StatusRequestTimeout, "request_timeout", "Request timed out")
+	ErrUserExists         = New(fiber.StatusConflict, "user_exists", "User already exists")
+	ErrOrderConflict      = New(fiber.StatusConflict, "order_owned_by_another_user", "Order number already uploaded by another user")
+	ErrOrderExists        = New(fiber.StatusConflict, "order_exists", "Order number already exists")
+	ErrInvalidOrderFormat = New(fiber.StatusUnprocessableEntity, "invalid_order_format", "Order number must contain only digits")
+	ErrInvalidLuhn        = New(fiber.StatusUnprocessableEntity, "invalid_luhn", "Order number fails the Luhn check")
+	ErrInternal           = New(fiber.StatusInternalServerError, "internal_error", "Internal server error")
+	ErrServiceUnavailable = New(fiber.StatusServiceUnavailable, "service_unavailable", "Server is shutting down")
+)
+
+// Send пишет problem+json ответ
+func Send(c *fiber.Ctx, p *Problem) error {
+	response := *p
+	if response.Instance == "" {
+		response.Instance = c.OriginalURL()
+	}
+
+	return c.Status(response.Status).JSON(response, ContentType)
+}
+
+// ErrorHandler — центральный обработчик ошибок Fiber, приводящий все ошибки к problem+json
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var p *Problem
+	if errors.As(err, &p) {
+		return Send(c, p)
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return Send(c, fromStatus(fiberErr.Code, fiberErr.Message))
+	}
+
+	logger.HTTP.Error("Unhandled error", zap.String("path", c.Path()), zap.Error(err))
+	return Send(c, ErrInternal)
+}
+
+// Middleware отрисовывает ошибку обработчика один раз, чтобы внешние слои (трейсинг, логи,
+// метрики) видели итоговый статус ответа, и сохраняет её для них в Locals
+func Middleware(c *fiber.Ctx) error {
+	err := c.Next()
+	if err == nil {
+		return nil
+	}
+
+	c.Locals(errorKey, err)
+	if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+		_ = c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return nil
+}
+
+// RenderedError возвращает ошибку, отрисованную Middleware, или nil
+func RenderedError(c *fiber.Ctx) error {
+	err, _ := c.Locals(errorKey).(error)
+	return err
+}
+
+func fromStatus(status int, detail string) *Problem {
+	if status >= fiber.StatusInternalServerError {
+		return ErrInternal
+	}
+
+	title := http.StatusText(status)
+	if title == "" {
+		title = "Error"
+	}
+
+	code := strings.ToLower(strings.ReplaceAll(title, " ", "_"))
+	p := New(status, code, title)
+	if detail != title {
+		p.Detail = detail
+	}
+	return p
+}
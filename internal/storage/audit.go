@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"strings"
+)
+
+func CreateAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = insertAuditEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertAuditEntry пишет запись аудита в рамках транзакции, выполняющей само действие
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, entry models.AuditEntry) error {
+	var details interface{}
+	if len(entry.Details) > 0 {
+		details = []byte(entry.Details)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (action, actor_id, actor_login, ip, user_agent, request_id, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`, entry.Action, entry.ActorID, entry.ActorLogin, entry.IP, entry.UserAgent, entry.RequestID, details)
+
+	return err
+}
+
+// StreamAuditEntries построчно отдаёт записи журнала аудита, подходящие под фильтр, в порядке создания
+func StreamAuditEntries(ctx context.Context, filter models.AuditFilter, fn func(models.AuditEntry) error) error {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorID != nil {
+		addCondition("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	query := `SELECT id, created_at, action, actor_id, actor_login, ip, user_agent, request_id, details FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var details []byte
+		err = rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Action, &entry.ActorID, &entry.ActorLogin,
+			&entry.IP, &entry.UserAgent, &entry.RequestID, &details)
+		if err != nil {
+			return err
+		}
+		entry.Details = details
+
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
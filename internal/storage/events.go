@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"time"
+)
+
+// InsertStreamEvent сохраняет событие потока пользователя и той же командой рассылает его через
+// StreamEventsChannel всем экземплярам сервиса. ID берётся из последовательности БД, поэтому
+// Last-Event-ID остаётся действительным после перезапуска и на другом экземпляре.
+// Уведомление уходит при фиксации, его размер ограничен 8000 байт
+func InsertStreamEvent(ctx context.Context, userID uuid.UUID, eventType string, payload []byte) (models.StreamEvent, error) {
+	var event models.StreamEvent
+
+	err := DB.QueryRowContext(ctx, `
+		WITH inserted AS (
+			INSERT INTO stream_events (user_id, event_type, payload) VALUES ($1, $2, $3)
+			RETURNING id, user_id, event_type, payload, created_at
+		), notified AS (
+			SELECT pg_notify($4, json_build_object('id', id, 'user_id', user_id, 'type', event_type, 'data', payload)::text)
+			FROM inserted
+		)
+		SELECT id, user_id, event_type, payload, created_at FROM inserted, notified;
+	`, userID, eventType, payload, StreamEventsChannel).Scan(&event.ID, &event.UserID, &event.Type, &event.Payload, &event.CreatedAt)
+
+	if err != nil {
+		return models.StreamEvent{}, err
+	}
+
+	return event, nil
+}
+
+// GetStreamEvents возвращает не больше limit последних событий пользователя с ID больше afterID
+// в порядке возрастания ID
+func GetStreamEvents(ctx context.Context, userID uuid.UUID, afterID int64, limit int) ([]models.StreamEvent, error) {
+	var events []models.StreamEvent
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, user_id, event_type, payload, created_at FROM (
+			SELECT id, user_id, event_type, payload, created_at FROM stream_events
+			WHERE user_id = $1 AND id > $2
+			ORDER BY id DESC LIMIT $3
+		) latest ORDER BY id;
+	`, userID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.StreamEvent
+		if err = rows.Scan(&event.ID, &event.UserID, &event.Type, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// PruneStreamEvents удаляет события потока старше retention, возвращает число удалённых
+func PruneStreamEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	result, err := DB.ExecContext(ctx, `
+		DELETE FROM stream_events WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1);
+	`, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
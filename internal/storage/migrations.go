@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// migration — разовое изменение данных. Схема в Init создаётся идемпотентными командами
+// на каждом запуске, а миграция выполняется один раз: её номер сохраняется в schema_migrations
+type migration struct {
+	version    int
+	statements []string
+}
+
+// migrations применяются по возрастанию version; номера применённых миграций не меняются
+var migrations = []migration{
+	{
+		// Заказы, загруженные до появления outbox, ставятся в очередь повторно: система расчёта
+		// ответит 409 на уже известные ей заказы, и это считается успешной регистрацией.
+		// Номера списаний в систему расчёта не передаются
+		version: 1,
+		statements: []string{
+			`INSERT INTO accrual_registrations (order_id, order_number)
+			SELECT id, order_number FROM orders WHERE status = 'NEW' AND NOT EXISTS (` + withdrawalOrder + `)
+			ON CONFLICT (order_id) DO NOTHING;`,
+			`DELETE FROM accrual_registrations r USING withdrawals w
+			WHERE r.order_number = w.order_number AND r.registered_at IS NULL;`,
+		},
+	},
+}
+
+func applyMigrations(ctx context.Context) error {
+	for _, m := range migrations {
+		if err := applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration выполняет миграцию в одной транзакции с записью её номера. Если несколько
+// экземпляров стартуют одновременно, второй ждёт на вставке номера и, увидев конфликт, пропускает миграцию
+func applyMigration(ctx context.Context, m migration) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING;
+	`, m.version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		tx.Rollback()
+		return err
+	}
+
+	for _, statement := range m.statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkMigrationsApplied проверяет, что все миграции из migrations отмечены в schema_migrations
+func checkMigrationsApplied(ctx context.Context) error {
+	versions := make([]int64, 0, len(migrations))
+	for _, m := range migrations {
+		versions = append(versions, int64(m.version))
+	}
+
+	var count int
+	err := DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM schema_migrations WHERE version = ANY($1);
+	`, pq.Array(versions)).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != len(migrations) {
+		return ErrMigrationsIncomplete
+	}
+
+	return nil
+}
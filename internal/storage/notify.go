@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/sol1corejz/goferrrmart/cmd/config"
+)
+
+// NewOrdersChannel — канал NOTIFY, в который CreateOrder публикует номер нового заказа
+const NewOrdersChannel = "orders_new"
+
+// StreamEventsChannel — канал NOTIFY, в который InsertStreamEvent публикует сохранённое событие потока
+const StreamEventsChannel = "stream_events"
+
+// ListenNewOrders подписывается на NewOrdersChannel и вызывает fn с номером каждого нового заказа
+func ListenNewOrders(ctx context.Context, onListen func(), fn func(orderNumber string)) error {
+	return listen(ctx, NewOrdersChannel, onListen, fn)
+}
+
+// ListenStreamEvents подписывается на StreamEventsChannel и вызывает fn с событием в JSON
+func ListenStreamEvents(ctx context.Context, onListen func(), fn func(payload string)) error {
+	return listen(ctx, StreamEventsChannel, onListen, fn)
+}
+
+// listen открывает отдельное соединение pgx, подписывается на channel и вызывает fn с каждым
+// уведомлением. Соединение из пула для этого не подходит: подписка живёт, пока соединение открыто.
+// Возвращает ошибку при отмене ctx или обрыве соединения
+func listen(ctx context.Context, channel string, onListen func(), fn func(payload string)) error {
+	conn, err := pgx.Connect(ctx, config.Current.DatabaseURI)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	onListen()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		fn(notification.Payload)
+	}
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"time"
+)
+
+// pendingRegistration — условие для запросов по orders: заказ ещё не зарегистрирован
+// в системе расчёта, и опрашивать его статус рано
+const pendingRegistration = `SELECT 1 FROM accrual_registrations r WHERE r.order_id = orders.id AND r.registered_at IS NULL`
+
+// withdrawalOrder — условие для запросов по orders: номер занят списанием, а не загруженным заказом
+const withdrawalOrder = `SELECT 1 FROM withdrawals w WHERE w.order_number = orders.order_number`
+
+// ClaimDueRegistrations забирает до limit заказов, ожидающих регистрации, и сдвигает
+// их next_attempt_at на lease вперёд по часам базы — так же, как ClaimDueOrders
+func ClaimDueRegistrations(ctx context.Context, lease time.Duration, limit int) ([]models.AccrualRegistration, error) {
+	var registrations []models.AccrualRegistration
+
+	rows, err := DB.QueryContext(ctx, `
+		UPDATE accrual_registrations SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+		WHERE order_id IN (
+			SELECT order_id FROM accrual_registrations
+			WHERE registered_at IS NULL AND rejected_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING order_id, order_number, attempts;
+	`, lease.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var registration models.AccrualRegistration
+		if err = rows.Scan(&registration.OrderID, &registration.OrderNumber, &registration.Attempts); err != nil {
+			return nil, err
+		}
+		registrations = append(registrations, registration)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return registrations, nil
+}
+
+// MarkOrderRegistered завершает регистрацию и делает заказ доступным для опроса статуса
+func MarkOrderRegistered(ctx context.Context, orderID int) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE accrual_registrations
+		SET registered_at = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = NULL
+		WHERE order_id = $1;
+	`, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders SET next_check_at = CURRENT_TIMESTAMP WHERE id = $1;
+	`, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkRegistrationFailed записывает неудачную попытку регистрации и откладывает следующую на retryIn
+func MarkRegistrationFailed(ctx context.Context, orderID int, lastError string, retryIn time.Duration) error {
+	_, err := DB.ExecContext(ctx, `
+		UPDATE accrual_registrations
+		SET attempts = attempts + 1, last_error = $1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		WHERE order_id = $3;
+	`, lastError, retryIn.Seconds(), orderID)
+
+	return err
+}
+
+// RejectRegistration завершает регистрацию, которую система расчёта отклонила окончательно:
+// ошибка сохраняется в last_error, а заказ получает статус INVALID. Возвращает заказ после
+// изменения и false, если он уже был в финальном статусе
+func RejectRegistration(ctx context.Context, orderID int, lastError string) (models.Order, bool, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Order{}, false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE accrual_registrations
+		SET attempts = attempts + 1, last_error = $1, rejected_at = CURRENT_TIMESTAMP
+		WHERE order_id = $2;
+	`, lastError, orderID)
+	if err != nil {
+		tx.Rollback()
+		return models.Order{}, false, err
+	}
+
+	var order models.Order
+	err = tx.QueryRowContext(ctx, `
+		UPDATE orders SET status = $1
+		WHERE id = $2 AND status NOT IN ('INVALID', 'PROCESSED')
+		RETURNING id, user_id, order_number, status, accrual, uploaded_at, attempts, next_check_at;
+	`, models.INVALID, orderID).Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Status, &order.Accrual,
+		&order.UploadedAt, &order.Attempts, &order.NextCheckAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, false, tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		return models.Order{}, false, err
+	}
+
+	err = insertOutboxEvent(ctx, tx, order.UserID, models.EventOrderInvalid, map[string]interface{}{
+		"order":   order.OrderNumber,
+		"status":  order.Status,
+		"accrual": order.Accrual,
+	})
+	if err != nil {
+		tx.Rollback()
+		return models.Order{}, false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Order{}, false, err
+	}
+	return order, true, nil
+}
+
+// PostponeRegistrations переносит попытки на retryIn без увеличения счётчика: используется,
+// когда до системы расчёта не дошли (открыт выключатель, лимит запросов, остановка)
+func PostponeRegistrations(ctx context.Context, orderIDs []int, retryIn time.Duration) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	_, err := DB.ExecContext(ctx, `
+		UPDATE accrual_registrations SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+		WHERE order_id = ANY($2);
+	`, retryIn.Seconds(), pq.Array(orderIDs))
+
+	return err
+}
+
+// NextRegistrationAttemptAt возвращает ближайшее время попытки регистрации;
+// ok = false, если очередь пуста
+func NextRegistrationAttemptAt(ctx context.Context) (next time.Time, ok bool, err error) {
+	var nextAttemptAt sql.NullTime
+	err = DB.QueryRowContext(ctx, `
+		SELECT MIN(next_attempt_at) FROM accrual_registrations WHERE registered_at IS NULL AND rejected_at IS NULL;
+	`).Scan(&nextAttemptAt)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return nextAttemptAt.Time, nextAttemptAt.Valid, nil
+}
+
+func CountPendingRegistrations(ctx context.Context) (int, error) {
+	var count int
+	err := DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM accrual_registrations WHERE registered_at IS NULL AND rejected_at IS NULL;
+	`).Scan(&count)
+
+	return count, err
+}
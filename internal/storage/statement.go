@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"time"
+)
+
+// accrualDate — момент начисления: время обработки заказа, для заказов, обработанных
+// до появления processed_at, — время загрузки
+const accrualDate = "COALESCE(processed_at, uploaded_at)"
+
+// Statement читает выписку пользователя из одного снимка базы: остаток на начало и операции
+// берутся в транзакции REPEATABLE READ, поэтому остаток на начало плюс операции равен остатку на конец
+type Statement struct {
+	tx     *sql.Tx
+	userID uuid.UUID
+}
+
+// BeginStatement открывает транзакцию выписки, её нужно завершить через Close
+func BeginStatement(ctx context.Context, userID uuid.UUID) (*Statement, error) {
+	tx, err := DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Statement{tx: tx, userID: userID}, nil
+}
+
+// BalanceAt считает баланс пользователя на момент at по начислениям и списаниям
+func (s *Statement) BalanceAt(ctx context.Context, at time.Time) (float64, error) {
+	var balance float64
+
+	err := s.tx.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(accrual) FROM orders WHERE user_id = $1 AND status = $2 AND `+accrualDate+` < $3), 0) -
+			COALESCE((SELECT SUM(sum) FROM withdrawals WHERE user_id = $1 AND processed_at < $3), 0);
+	`, s.userID, models.PROCESSED, at).Scan(&balance)
+
+	return balance, err
+}
+
+// Stream построчно передаёт в fn начисления и списания за период [from, to) в хронологическом порядке
+func (s *Statement) Stream(ctx context.Context, from time.Time, to time.Time, fn func(models.StatementEntry) error) error {
+	rows, err := s.tx.QueryContext(ctx, `
+		SELECT `+accrualDate+` AS date, $4::text AS type, order_number, accrual AS amount FROM orders
+		WHERE user_id = $1 AND status = $6 AND accrual > 0 AND `+accrualDate+` >= $2 AND `+accrualDate+` < $3
+		UNION ALL
+		SELECT processed_at, $5::text, order_number, -sum FROM withdrawals
+		WHERE user_id = $1 AND processed_at >= $2 AND processed_at < $3
+		ORDER BY date, order_number;
+	`, s.userID, from, to, models.StatementAccrual, models.StatementWithdrawal, models.PROCESSED)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.StatementEntry
+		if err = rows.Scan(&entry.Date, &entry.Type, &entry.OrderNumber, &entry.Amount); err != nil {
+			return err
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Close завершает транзакцию выписки; она только читает, поэтому откатывается
+func (s *Statement) Close() error {
+	return s.tx.Rollback()
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"github.com/XSAM/otelsql"
 	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/lib/pq"
 	"github.com/sol1corejz/goferrrmart/cmd/config"
 	"github.com/sol1corejz/goferrrmart/internal/logger"
 	"github.com/sol1corejz/goferrrmart/internal/models"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.uber.org/zap"
 	"time"
 )
@@ -17,16 +20,19 @@ var (
 	DB                     *sql.DB
 	ErrConnectionFailed    = errors.New("db connection failed")
 	ErrCreatingTableFailed = errors.New("creating table failed")
+	ErrMigrationFailed     = errors.New("applying migration failed")
+	ErrOrderExists         = errors.New("order number already exists")
+	ErrInsufficientFunds   = errors.New("insufficient funds")
 )
 
-func Init() error {
-	if config.DatabaseURI == "" {
+func Init(ctx context.Context) error {
+	if config.Current.DatabaseURI == "" {
 		return ErrConnectionFailed
 	}
 
-	db, err := sql.Open("pgx", config.DatabaseURI)
+	db, err := otelsql.Open("pgx", config.Current.DatabaseURI, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
-		logger.Log.Fatal("Error opening database connection", zap.Error(err))
+		logger.Storage.Fatal("Error opening database connection", zap.Error(err))
 		return ErrConnectionFailed
 	}
 	DB = db
@@ -46,6 +52,12 @@ func Init() error {
 			accrual DECIMAL(10, 2) DEFAULT 0.00,
 			uploaded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);`,
+		`ALTER TABLE orders
+			ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS next_check_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;`,
+		// processed_at — когда заказ получил окончательный статус, по нему датируются начисления в выписке
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;`,
+		`CREATE INDEX IF NOT EXISTS orders_next_check_idx ON orders (next_check_at) WHERE status NOT IN ('INVALID', 'PROCESSED');`,
 		`CREATE TABLE IF NOT EXISTS user_balances (
     		id SERIAL PRIMARY KEY NOT NULL,
 			user_id UUID NOT NULL REFERENCES users(id),
@@ -59,18 +71,125 @@ func Init() error {
 			sum DECIMAL(10, 2) NOT NULL,
 			processed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);`,
+		`CREATE INDEX IF NOT EXISTS withdrawals_order_number_idx ON withdrawals (order_number);`,
+		`CREATE TABLE IF NOT EXISTS outbox_events (
+			id SERIAL PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id),
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			dispatched_at TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS outbox_events_undispatched_idx ON outbox_events (id) WHERE dispatched_at IS NULL;`,
+		`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id UUID PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id),
+			url TEXT NOT NULL,
+			secret VARCHAR(255) NOT NULL,
+			event_types TEXT[] NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id SERIAL PRIMARY KEY NOT NULL,
+			subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+			event_id INTEGER NOT NULL REFERENCES outbox_events(id),
+			status VARCHAR(20) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			response_code INTEGER,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_event_idx ON webhook_deliveries (event_id);`,
+		`CREATE TABLE IF NOT EXISTS order_items (
+			id SERIAL PRIMARY KEY NOT NULL,
+			order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			description TEXT NOT NULL,
+			price DECIMAL(10, 2) NOT NULL CHECK (price >= 0),
+			quantity INTEGER NOT NULL CHECK (quantity > 0)
+		);`,
+		`CREATE INDEX IF NOT EXISTS order_items_order_idx ON order_items (order_id);`,
+		`CREATE TABLE IF NOT EXISTS accrual_registrations (
+			order_id INTEGER PRIMARY KEY NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			order_number VARCHAR(255) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			registered_at TIMESTAMP
+		);`,
+		// rejected_at — система расчёта окончательно отклонила заказ (4xx), попытки прекращены
+		`ALTER TABLE accrual_registrations ADD COLUMN IF NOT EXISTS rejected_at TIMESTAMP;`,
+		`DROP INDEX IF EXISTS accrual_registrations_due_idx;`,
+		`CREATE INDEX IF NOT EXISTS accrual_registrations_pending_idx ON accrual_registrations (next_attempt_at)
+		WHERE registered_at IS NULL AND rejected_at IS NULL;`,
+		// События потока заказов: ID из последовательности служит Last-Event-ID на всех экземплярах
+		`CREATE TABLE IF NOT EXISTS stream_events (
+			id BIGSERIAL PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id),
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS stream_events_user_idx ON stream_events (user_id, id);`,
+		`CREATE INDEX IF NOT EXISTS stream_events_created_at_idx ON stream_events (created_at);`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			action VARCHAR(50) NOT NULL,
+			actor_id UUID,
+			actor_login VARCHAR(255) NOT NULL DEFAULT '',
+			ip VARCHAR(64) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			request_id VARCHAR(128) NOT NULL DEFAULT '',
+			details JSONB
+		);`,
+		`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);`,
+		`CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor_id, created_at);`,
+		// Журнал аудита только дополняется: изменение и удаление записей запрещены на уровне БД
+		`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;`,
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'audit_log_append_only') THEN
+				CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+				FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+			END IF;
+		END;
+		$$;`,
 	}
 
 	for _, table := range tables {
-		if _, err := DB.Exec(table); err != nil {
-			logger.Log.Error("Error creating table", zap.Error(err))
+		if _, err := DB.ExecContext(ctx, table); err != nil {
+			logger.Storage.Error("Error creating table", zap.Error(err))
 			return ErrCreatingTableFailed
 		}
 	}
 
+	if err := applyMigrations(ctx); err != nil {
+		logger.Storage.Error("Error applying migrations", zap.Error(err))
+		return ErrMigrationFailed
+	}
+
 	return nil
 }
 
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	return DB.Close()
+}
+
 func GetUserByLogin(ctx context.Context, login string) (models.User, error) {
 
 	var existingUser models.User
@@ -123,26 +242,78 @@ func CreateUser(ctx context.Context, userID string, login string, passwordHash s
 	return nil
 }
 
-func CreateOrder(ctx context.Context, userID string, orderNumber string) error {
+// CreateOrder сохраняет заказ с товарами, ставит его в очередь регистрации в системе расчёта
+// и публикует его номер в NewOrdersChannel. Всё это — одна команда: уведомление доставляется
+// слушателям только после фиксации вставки, а заказ не может остаться без регистрации
+func CreateOrder(ctx context.Context, userID string, orderNumber string, items []models.OrderItem) error {
+	descriptions := make([]string, 0, len(items))
+	prices := make([]float64, 0, len(items))
+	quantities := make([]int64, 0, len(items))
+	for _, item := range items {
+		descriptions = append(descriptions, item.Description)
+		prices = append(prices, item.Price)
+		quantities = append(quantities, int64(item.Quantity))
+	}
 
 	_, err := DB.ExecContext(ctx, `
-        INSERT INTO orders (user_id, order_number, status) VALUES ($1, $2, $3) ON CONFLICT (order_number) DO NOTHING;
-    `, userID, orderNumber, models.NEW)
+        WITH inserted AS (
+            INSERT INTO orders (user_id, order_number, status) VALUES ($1, $2, $3)
+            ON CONFLICT (order_number) DO NOTHING
+            RETURNING id, order_number
+        ), items AS (
+            INSERT INTO order_items (order_id, description, price, quantity)
+            SELECT inserted.id, item.description, item.price, item.quantity
+            FROM inserted, unnest($5::text[], $6::numeric[], $7::integer[]) AS item(description, price, quantity)
+        ), registration AS (
+            INSERT INTO accrual_registrations (order_id, order_number)
+            SELECT id, order_number FROM inserted
+        )
+        SELECT pg_notify($4, order_number) FROM inserted;
+    `, userID, orderNumber, models.NEW, NewOrdersChannel, pq.Array(descriptions), pq.Array(prices), pq.Array(quantities))
 
 	if err != nil {
-		logger.Log.Error("Error creating order: %v", zap.Error(err))
+		logger.Storage.Error("Error creating order: %v", zap.Error(err))
 		return err
 	}
 
 	return nil
 }
 
+// GetOrderItems возвращает товары заказа в порядке загрузки
+func GetOrderItems(ctx context.Context, orderID int) ([]models.OrderItem, error) {
+	var items []models.OrderItem
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, order_id, description, price, quantity FROM order_items WHERE order_id = $1 ORDER BY id;
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		if err = rows.Scan(&item.ID, &item.OrderID, &item.Description, &item.Price, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
 func GetUserOrders(ctx context.Context, UUID uuid.UUID) ([]models.Order, error) {
 
 	var orders []models.Order
 
 	rows, err := DB.QueryContext(ctx, `
-		SELECT * FROM orders WHERE user_id = $1;
+		SELECT id, user_id, order_number, status, accrual, uploaded_at FROM orders
+		WHERE user_id = $1 AND NOT EXISTS (`+withdrawalOrder+`);
 	`, UUID)
 
 	if err != nil {
@@ -174,7 +345,7 @@ func GetOrderByNumber(ctx context.Context, orderNumber string) (models.Order, er
 	var order models.Order
 
 	err := DB.QueryRowContext(ctx, `
-		SELECT * FROM orders WHERE order_number = $1;
+		SELECT id, user_id, order_number, status, accrual, uploaded_at FROM orders WHERE order_number = $1;
 	`, orderNumber).Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Status, &order.Accrual, &order.UploadedAt)
 
 	if err != nil {
@@ -232,12 +403,52 @@ func GetUserWithdrawals(ctx context.Context, UUID uuid.UUID) ([]models.Withdrawa
 	return withdrawals, nil
 }
 
-func CreateWithdrawal(ctx context.Context, userID uuid.UUID, order string, sum float64) error {
+// CreateWithdrawal списывает баллы в счёт заказа. Номер заказа занимается в orders в той же
+// транзакции, но без регистрации в системе расчёта: начислений по нему не будет, и воркер его
+// не опрашивает. Если номер уже занят, возвращает ErrOrderExists
+// CreateWithdrawal списывает sum с баланса пользователя; запись аудита auditEntry пишется
+// в той же транзакции, поэтому списание без записи в журнале невозможно.
+// Проверка баланса и списание — одно условное обновление: оно блокирует строку баланса,
+// и параллельные списания не уводят баланс в минус
+func CreateWithdrawal(ctx context.Context, userID uuid.UUID, order string, sum float64, auditEntry models.AuditEntry) error {
 	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_balances
+		SET current_balance = current_balance - $1, withdrawn_total = withdrawn_total + $1
+		WHERE user_id = $2 AND current_balance >= $1
+	`, sum, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return ErrInsufficientFunds
+	}
+
+	result, err = tx.ExecContext(ctx, `
+		INSERT INTO orders (user_id, order_number, status) VALUES ($1, $2, $3)
+		ON CONFLICT (order_number) DO NOTHING;
+	`, userID, order, models.NEW)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return ErrOrderExists
+	}
+
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO withdrawals (user_id, order_number, sum, processed_at) 
 		VALUES ($1, $2, $3, $4)
@@ -247,16 +458,20 @@ func CreateWithdrawal(ctx context.Context, userID uuid.UUID, order string, sum f
 		return err
 	}
 
-	_, err = tx.ExecContext(ctx, `
-		UPDATE user_balances 
-		SET current_balance = current_balance - $1, withdrawn_total = withdrawn_total + $1 
-		WHERE user_id = $2
-	`, sum, userID)
+	err = insertOutboxEvent(ctx, tx, userID, models.EventWithdrawalCreated, map[string]interface{}{
+		"order": order,
+		"sum":   sum,
+	})
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	if err = insertAuditEntry(ctx, tx, auditEntry); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -265,24 +480,36 @@ func CreateWithdrawal(ctx context.Context, userID uuid.UUID, order string, sum f
 	return nil
 }
 
-func GetAllUnprocessedOrders(ctx context.Context) ([]models.Order, error) {
+// ClaimDueOrders забирает до limit незавершённых заказов, время проверки которых наступило,
+// и сдвигает их next_check_at на lease вперёд. Пока аренда не истекла, другие экземпляры воркера
+// эти заказы не видят; SKIP LOCKED не даёт им ждать друг друга на одних и тех же строках.
+// Если воркер упадёт, заказы снова станут доступны по истечении аренды. Время берётся
+// из часов базы, как и в ReleaseOrders, поэтому расхождение часов экземпляров не влияет на аренду
+func ClaimDueOrders(ctx context.Context, lease time.Duration, limit int) ([]models.Order, error) {
 	var orders []models.Order
 
 	rows, err := DB.QueryContext(ctx, `
-		SELECT * FROM orders WHERE status NOT IN ('INVALID', 'PROCESSED');;
-	`)
-
+		UPDATE orders SET next_check_at = CURRENT_TIMESTAMP + make_interval(secs => $1)
+		WHERE id IN (
+			SELECT id FROM orders
+			WHERE status NOT IN ('INVALID', 'PROCESSED') AND next_check_at <= CURRENT_TIMESTAMP
+				AND NOT EXISTS (`+pendingRegistration+`) AND NOT EXISTS (`+withdrawalOrder+`)
+			ORDER BY next_check_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, order_number, status, accrual, uploaded_at, attempts, next_check_at;
+	`, lease.Seconds(), limit)
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return []models.Order{}, err
-		}
+		return nil, err
 	}
 
 	defer rows.Close()
 
 	for rows.Next() {
 		var order models.Order
-		err = rows.Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Status, &order.Accrual, &order.UploadedAt)
+		err = rows.Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Status, &order.Accrual, &order.UploadedAt,
+			&order.Attempts, &order.NextCheckAt)
 		if err != nil {
 			return nil, err
 		}
@@ -296,28 +523,230 @@ func GetAllUnprocessedOrders(ctx context.Context) ([]models.Order, error) {
 	return orders, nil
 }
 
-func UpdateOrder(ctx context.Context, orderID int, orderStatus string, orderAccrual float64, userID uuid.UUID) error {
-	tx, err := DB.BeginTx(ctx, nil)
+// ReleaseOrders возвращает необработанные заказы из аренды, чтобы их сразу смог забрать любой воркер
+func ReleaseOrders(ctx context.Context, orderIDs []int) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	_, err := DB.ExecContext(ctx, `
+		UPDATE orders SET next_check_at = CURRENT_TIMESTAMP WHERE id = ANY($1);
+	`, pq.Array(orderIDs))
+
+	return err
+}
+
+// NextOrderCheckAt возвращает ближайшее время проверки незавершённого заказа;
+// ok = false, если таких заказов нет
+func NextOrderCheckAt(ctx context.Context) (next time.Time, ok bool, err error) {
+	var nextCheckAt sql.NullTime
+	err = DB.QueryRowContext(ctx, `
+		SELECT MIN(next_check_at) FROM orders
+		WHERE status NOT IN ('INVALID', 'PROCESSED')
+			AND NOT EXISTS (`+pendingRegistration+`) AND NOT EXISTS (`+withdrawalOrder+`);
+	`).Scan(&nextCheckAt)
 	if err != nil {
-		return err
+		return time.Time{}, false, err
 	}
 
-	_, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1, accrual = $2 WHERE id = $3`, orderStatus, orderAccrual, orderID)
+	return nextCheckAt.Time, nextCheckAt.Valid, nil
+}
+
+func CountUnprocessedOrders(ctx context.Context) (int, error) {
+	var count int
+	err := DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM orders
+		WHERE status NOT IN ('INVALID', 'PROCESSED') AND NOT EXISTS (`+withdrawalOrder+`);
+	`).Scan(&count)
+
+	return count, err
+}
+
+// ScheduleOrderCheck откладывает следующую проверку заказа на checkIn и увеличивает счётчик попыток
+func ScheduleOrderCheck(ctx context.Context, orderID int, checkIn time.Duration) error {
+	_, err := DB.ExecContext(ctx, `
+		UPDATE orders SET attempts = attempts + 1, next_check_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		WHERE id = $1;
+	`, orderID, checkIn.Seconds())
+
+	return err
+}
+
+// UpdateOrder сохраняет ответ системы расчёта. Заказ в финальном статусе не меняется, поэтому
+// начисление на баланс происходит ровно один раз, даже если один заказ обработали два воркера.
+// Возвращает false, если заказ уже был завершён
+func UpdateOrder(ctx context.Context, orderID int, orderStatus string, orderAccrual float64, userID uuid.UUID) (bool, error) {
+	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return false, err
 	}
 
-	_, err = tx.ExecContext(ctx, `UPDATE user_balances SET current_balance = $1 WHERE user_id = $2`, orderAccrual, userID)
+	var orderNumber string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE orders SET status = $1, accrual = $2,
+			processed_at = CASE WHEN $1 IN ('INVALID', 'PROCESSED') THEN CURRENT_TIMESTAMP ELSE processed_at END
+		WHERE id = $3 AND status NOT IN ('INVALID', 'PROCESSED')
+		RETURNING order_number
+	`, orderStatus, orderAccrual, orderID).Scan(&orderNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return false, nil
+	}
 	if err != nil {
 		tx.Rollback()
-		return err
+		return false, err
+	}
+
+	if eventType, ok := orderEventTypes[orderStatus]; ok {
+		err = insertOutboxEvent(ctx, tx, userID, eventType, map[string]interface{}{
+			"order":   orderNumber,
+			"status":  orderStatus,
+			"accrual": orderAccrual,
+		})
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if orderStatus == models.PROCESSED {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE user_balances SET current_balance = current_balance + $1 WHERE user_id = $2
+		`, orderAccrual, userID)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
 	}
 
 	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func GetUserOrdersPage(ctx context.Context, UUID uuid.UUID, limit int, offset int) ([]models.Order, int, error) {
+	var total int
+
+	err := DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM orders WHERE user_id = $1 AND NOT EXISTS (`+withdrawalOrder+`);
+	`, UUID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, user_id, order_number, status, accrual, uploaded_at FROM orders
+		WHERE user_id = $1 AND NOT EXISTS (`+withdrawalOrder+`)
+		ORDER BY uploaded_at DESC, id DESC
+		LIMIT $2 OFFSET $3;
+	`, UUID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		err = rows.Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Status, &order.Accrual, &order.UploadedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
+}
+
+func GetUserWithdrawalsPage(ctx context.Context, UUID uuid.UUID, limit int, offset int) ([]models.Withdrawal, int, error) {
+	var total int
+
+	err := DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM withdrawals WHERE user_id = $1;
+	`, UUID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, user_id, order_number, sum, processed_at FROM withdrawals
+		WHERE user_id = $1
+		ORDER BY processed_at DESC, id DESC
+		LIMIT $2 OFFSET $3;
+	`, UUID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var withdrawals []models.Withdrawal
+	for rows.Next() {
+		var withdrawal models.Withdrawal
+		err = rows.Scan(&withdrawal.ID, &withdrawal.UserID, &withdrawal.OrderNumber, &withdrawal.Sum, &withdrawal.ProcessedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return withdrawals, total, nil
+}
+
+var requiredTables = []string{
+	"users",
+	"orders",
+	"user_balances",
+	"withdrawals",
+	"outbox_events",
+	"webhook_subscriptions",
+	"webhook_deliveries",
+	"audit_log",
+	"order_items",
+	"accrual_registrations",
+	"stream_events",
+	"schema_migrations",
+}
+
+var ErrMigrationsIncomplete = errors.New("database schema is incomplete")
+
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return ErrConnectionFailed
+	}
+	return DB.PingContext(ctx)
+}
+
+// CheckMigrations проверяет, что все таблицы, создаваемые в Init, существуют и разовые миграции применены
+func CheckMigrations(ctx context.Context) error {
+	if DB == nil {
+		return ErrConnectionFailed
+	}
+
+	var count int
+	err := DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = ANY($1);
+	`, pq.Array(requiredTables)).Scan(&count)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if count != len(requiredTables) {
+		return ErrMigrationsIncomplete
+	}
+
+	return checkMigrationsApplied(ctx)
 }
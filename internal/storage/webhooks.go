@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"time"
+)
+
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+var orderEventTypes = map[string]string{
+	models.PROCESSED: models.EventOrderProcessed,
+	models.INVALID:   models.EventOrderInvalid,
+}
+
+// insertOutboxEvent пишет событие в outbox в рамках транзакции, изменившей данные
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, userID uuid.UUID, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox_events (user_id, event_type, payload) VALUES ($1, $2, $3);
+	`, userID, eventType, payload)
+
+	return err
+}
+
+func CreateWebhookSubscription(ctx context.Context, subscription models.WebhookSubscription) (models.WebhookSubscription, error) {
+	err := DB.QueryRowContext(ctx, `
+		INSERT INTO webhook_subscriptions (id, user_id, url, secret, event_types)
+		VALUES ($1, $2, $3, $4, $5) RETURNING created_at;
+	`, subscription.ID, subscription.UserID, subscription.URL, subscription.Secret, pq.Array(subscription.EventTypes)).Scan(&subscription.CreatedAt)
+
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	return subscription, nil
+}
+
+func GetUserWebhookSubscriptions(ctx context.Context, userID uuid.UUID) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, user_id, url, secret, event_types, created_at
+		FROM webhook_subscriptions WHERE user_id = $1 ORDER BY created_at;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var subscription models.WebhookSubscription
+		err = rows.Scan(&subscription.ID, &subscription.UserID, &subscription.URL, &subscription.Secret, pq.Array(&subscription.EventTypes), &subscription.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func DeleteWebhookSubscription(ctx context.Context, userID uuid.UUID, subscriptionID uuid.UUID) error {
+	result, err := DB.ExecContext(ctx, `
+		DELETE FROM webhook_subscriptions WHERE id = $1 AND user_id = $2;
+	`, subscriptionID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+func GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, subscriptionID uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	var exists bool
+	err := DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id = $1 AND user_id = $2);
+	`, subscriptionID, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	var deliveries []models.WebhookDelivery
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT d.id, d.subscription_id, d.event_id, e.event_type, d.status, d.attempts, d.next_attempt_at,
+			d.response_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d
+		JOIN outbox_events e ON e.id = d.event_id
+		WHERE d.subscription_id = $1
+		ORDER BY d.id DESC
+		LIMIT $2;
+	`, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Status, &delivery.Attempts,
+			&delivery.NextAttemptAt, &delivery.ResponseCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// FanOutOutboxEvents создаёт доставки для подписок, подходящих под ещё не разосланные события outbox
+func FanOutOutboxEvents(ctx context.Context, limit int) (int, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, event_type FROM outbox_events
+		WHERE dispatched_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED;
+	`, limit)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		if err = rows.Scan(&event.ID, &event.UserID, &event.EventType); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, event := range events {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (subscription_id, event_id, status)
+			SELECT id, $1, $2 FROM webhook_subscriptions WHERE user_id = $3 AND $4 = ANY(event_types);
+		`, event.ID, models.DeliveryPending, event.UserID, event.EventType)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE outbox_events SET dispatched_at = CURRENT_TIMESTAMP WHERE id = $1;
+		`, event.ID)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// ClaimDueWebhookDeliveries забирает до limit доставок, время попытки которых наступило, и сдвигает
+// их next_attempt_at на lease. Как и в ClaimDueOrders, время считается часами базы, а SKIP LOCKED
+// не даёт двум экземплярам отправить одну доставку
+func ClaimDueWebhookDeliveries(ctx context.Context, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	rows, err := DB.QueryContext(ctx, `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+			FROM due WHERE d.id = due.id
+			RETURNING d.id, d.subscription_id, d.event_id, d.status, d.attempts, d.created_at
+		)
+		SELECT c.id, c.subscription_id, c.event_id, e.event_type, e.payload, c.status, c.attempts,
+			c.created_at, s.url, s.secret
+		FROM claimed c
+		JOIN outbox_events e ON e.id = c.event_id
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		ORDER BY c.id;
+	`, models.DeliveryPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+			&delivery.Status, &delivery.Attempts, &delivery.CreatedAt, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func MarkWebhookDelivered(ctx context.Context, deliveryID int, responseCode int) error {
+	_, err := DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, response_code = $2, last_error = NULL, delivered_at = CURRENT_TIMESTAMP
+		WHERE id = $3;
+	`, models.DeliveryDelivered, responseCode, deliveryID)
+
+	return err
+}
+
+// MarkWebhookDeliveryFailed записывает неудачную попытку и откладывает следующую на retryIn;
+// при dead доставка переходит в dead-letter
+func MarkWebhookDeliveryFailed(ctx context.Context, deliveryID int, responseCode *int, lastError string, retryIn time.Duration, dead bool) error {
+	status := models.DeliveryPending
+	if dead {
+		status = models.DeliveryDead
+	}
+
+	_, err := DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, response_code = $2, last_error = $3,
+			next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $4)
+		WHERE id = $5;
+	`, status, responseCode, lastError, retryIn.Seconds(), deliveryID)
+
+	return err
+}
+
+// PruneWebhookHistory удаляет завершённые (доставленные и мёртвые) доставки и разосланные события
+// outbox старше retention. События, по которым ещё есть доставки, остаются
+func PruneWebhookHistory(ctx context.Context, retention time.Duration) (deliveries int64, events int64, err error) {
+	result, err := DB.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status IN ($1, $2) AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $3);
+	`, models.DeliveryDelivered, models.DeliveryDead, retention.Seconds())
+	if err != nil {
+		return 0, 0, err
+	}
+	if deliveries, err = result.RowsAffected(); err != nil {
+		return 0, 0, err
+	}
+
+	result, err = DB.ExecContext(ctx, `
+		DELETE FROM outbox_events e
+		WHERE e.dispatched_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+			AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id);
+	`, retention.Seconds())
+	if err != nil {
+		return deliveries, 0, err
+	}
+	if events, err = result.RowsAffected(); err != nil {
+		return deliveries, 0, err
+	}
+
+	return deliveries, events, nil
+}
@@ -0,0 +1,168 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// WatchInterval — как часто проверяются изменения файлов сертификата и ключа
+const WatchInterval = 10 * time.Second
+
+var errNoCertificates = errors.New("no certificates found")
+
+// CertReloader хранит пару сертификат/ключ и перечитывает её при изменении файлов,
+// не прерывая уже установленные соединения
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch проверяет файлы раз в interval до отмены ctx; при ошибке загрузки остаётся прежний сертификат
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				logger.Log.Error("Error checking certificate files", zap.String("cert", r.certFile), zap.Error(err))
+				continue
+			}
+
+			r.mu.RLock()
+			changed := modTime.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err = r.reload(); err != nil {
+				logger.Log.Error("Error reloading certificate", zap.String("cert", r.certFile), zap.Error(err))
+				continue
+			}
+			logger.Log.Info("Certificate reloaded", zap.String("cert", r.certFile))
+		}
+	}
+}
+
+func (r *CertReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadCAPool читает PEM-бандл доверенных сертификатов
+func LoadCAPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: %w", file, errNoCertificates)
+	}
+	return pool, nil
+}
+
+// Server возвращает TLS-конфигурацию сервера; если задан clientCAFile, клиентский сертификат
+// проверяется по нему, но не обязателен — решение о доступе принимает обработчик
+func Server(reloader *CertReloader, clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if clientCAFile != "" {
+		pool, err := LoadCAPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+// Client возвращает TLS-конфигурацию исходящих соединений с собственным CA-бандлом
+// и/или клиентским сертификатом
+func Client(caFile string, clientCert *CertReloader) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := LoadCAPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if clientCert != nil {
+		cfg.GetClientCertificate = clientCert.GetClientCertificate
+	}
+
+	return cfg, nil
+}
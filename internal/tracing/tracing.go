@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sol1corejz/goferrrmart/internal/problem"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const serviceName = "gophermart"
+
+var Tracer = otel.Tracer("github.com/sol1corejz/goferrrmart")
+
+// Init настраивает глобальный TracerProvider; адрес OTLP и прочие параметры
+// экспортёра берутся из стандартных переменных OTEL_EXPORTER_OTLP_*
+func Init(ctx context.Context, exporterName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterName {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q", exporterName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES имеют приоритет
+	res, err = resource.Merge(res, resource.Environment())
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Middleware создаёт span на каждый входящий запрос и кладёт его в UserContext
+func Middleware(c *fiber.Ctx) error {
+	carrier := propagation.HeaderCarrier{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		carrier.Set(string(key), string(value))
+	})
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+	ctx, span := Tracer.Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.ClientAddress(c.IP()),
+			semconv.UserAgentOriginal(c.Get(fiber.HeaderUserAgent)),
+		),
+	)
+	defer span.End()
+
+	c.SetUserContext(ctx)
+
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	route := c.Route().Path
+	status := c.Response().StatusCode()
+
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(
+		semconv.HTTPRoute(route),
+		semconv.HTTPResponseStatusCode(status),
+	)
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	if err := problem.RenderedError(c); err != nil {
+		span.RecordError(err)
+	}
+
+	return nil
+}
+
+// StartSpan — обёртка для внутренних операций (циклы воркеров и т.п.)
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
@@ -2,121 +2,369 @@ package workers
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"github.com/sol1corejz/goferrrmart/cmd/config"
-	"github.com/sol1corejz/goferrrmart/internal/auth"
+	"errors"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"github.com/sol1corejz/goferrrmart/internal/hub"
 	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/metrics"
 	"github.com/sol1corejz/goferrrmart/internal/models"
 	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"github.com/sol1corejz/goferrrmart/internal/tracing"
 	"go.uber.org/zap"
-	"io"
-	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
-type LoyaltyResponse struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
-}
+const (
+	// WorkerInterval — минимальная пауза между плановыми проверками и интервал опроса,
+	// пока подписка на новые заказы недоступна
+	WorkerInterval = 5 * time.Second
+	// WorkerSweepInterval — страховочная проверка при работающей подписке: подбирает заказы,
+	// уведомления о которых потерялись
+	WorkerSweepInterval = time.Minute
+	// WorkerListenRetry — пауза перед переподключением LISTEN после обрыва соединения
+	WorkerListenRetry  = 5 * time.Second
+	WorkerQueryTimeout = 10 * time.Second
+	WorkerOrderTimeout = 10 * time.Second
+	WorkerBatchSize    = 100
+	OrderBaseBackoff   = 5 * time.Second
+	OrderMaxBackoff    = 30 * time.Minute
+	// WorkerLeaseDuration — на сколько заказы закрепляются за экземпляром воркера
+	WorkerLeaseDuration = 2 * time.Minute
+)
 
-const WorkerInterval = 5 * time.Second
+var (
+	// newOrders будит воркер начислений, когда заказы становятся доступны для опроса,
+	// newRegistrations — диспетчер регистрации при уведомлении о новом заказе.
+	// Лишние сигналы схлопываются
+	newOrders        = make(chan struct{}, 1)
+	newRegistrations = make(chan struct{}, 1)
+	listening        atomic.Bool
+)
 
-func InitLoyaltySystem() {
-	go startWorker()
+// InitLoyaltySystem запускает воркер начислений и диспетчер регистрации заказов, которые
+// останавливаются после отмены shutdown; начатая итерация доводится до конца, чтобы не прерывать транзакции
+func InitLoyaltySystem(shutdown context.Context) {
+	wg.Add(3)
+	go listenNewOrders(shutdown)
+	go startWorker(shutdown)
+	go startRegistrationDispatcher(shutdown)
 
-	logger.Log.Info("Loyalty system worker started")
+	logger.Worker.Info("Loyalty system worker started")
 }
 
-func startWorker() {
-	ticker := time.NewTicker(WorkerInterval)
-	for range ticker.C {
-		checkOrdersForProcessing()
+// startWorker проверяет заказы сразу после их регистрации в системе расчёта, а в остальное время —
+// к ближайшему сроку проверки уже известных заказов
+func startWorker(shutdown context.Context) {
+	defer wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-shutdown.Done():
+			logger.Worker.Info("Loyalty system worker stopped")
+			return
+		case <-newOrders:
+		case <-timer.C:
+		}
+
+		checkOrdersForProcessing(shutdown)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(nextCheckDelay(time.Now()))
 	}
 }
 
-func checkOrdersForProcessing() {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+// nextCheckDelay выбирает паузу до следующей плановой проверки: не меньше WorkerInterval
+// и не больше WorkerSweepInterval. Без подписки воркер опрашивает базу каждые WorkerInterval
+func nextCheckDelay(now time.Time) time.Duration {
+	return nextDelay(now, storage.NextOrderCheckAt)
+}
+
+// nextDelay ограничивает паузу до ближайшего срока, который возвращает next, интервалами
+// WorkerInterval и WorkerSweepInterval; без подписки на новые заказы возвращает WorkerInterval
+func nextDelay(now time.Time, next func(ctx context.Context) (time.Time, bool, error)) time.Duration {
+	if !listening.Load() {
+		return WorkerInterval
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
 	defer cancel()
 
+	at, ok, err := next(ctx)
+	if err != nil {
+		logger.Worker.Error("Error getting next check time", zap.Error(err))
+		return WorkerInterval
+	}
+	if !ok {
+		return WorkerSweepInterval
+	}
+
+	delay := at.Sub(now)
+	if delay < WorkerInterval {
+		return WorkerInterval
+	}
+	if delay > WorkerSweepInterval {
+		return WorkerSweepInterval
+	}
+	return delay
+}
+
+// listenNewOrders держит подписку на уведомления о новых заказах и переподключается при обрыве.
+// После каждого подключения воркеры будятся, чтобы подобрать заказы, созданные без подписки
+func listenNewOrders(shutdown context.Context) {
+	defer wg.Done()
+
+	for {
+		err := storage.ListenNewOrders(shutdown, func() {
+			listening.Store(true)
+			logger.Worker.Info("Listening for new orders")
+			wake(newOrders)
+			wake(newRegistrations)
+		}, func(orderNumber string) {
+			logger.Worker.Debug("New order notification", zap.String("orderNumber", orderNumber))
+			wake(newRegistrations)
+		})
+		listening.Store(false)
+
+		if shutdown.Err() != nil {
+			return
+		}
+		logger.Worker.Warn("New orders subscription lost, falling back to polling", zap.Error(err))
+
+		select {
+		case <-shutdown.Done():
+			return
+		case <-time.After(WorkerListenRetry):
+		}
+	}
+}
+
+// wake будит воркер, не блокируясь, если он уже разбужен
+func wake(ch chan struct{}) {
 	select {
-	case <-ctx.Done():
-		logger.Log.Info("Cancelling orders")
+	case ch <- struct{}{}:
 	default:
-		orders, err := storage.GetAllUnprocessedOrders(ctx)
+	}
+}
 
-		if err != nil {
-			logger.Log.Error("Error getting orders", zap.Error(err))
+// checkOrdersForProcessing опрашивает систему расчёта по незавершённым заказам, время проверки которых наступило.
+// Каждый заказ обрабатывается со своим таймаутом; при остановке новые заказы не берутся,
+// а начатая обработка заказа доводится до конца
+func checkOrdersForProcessing(shutdown context.Context) {
+	if backoffActive(time.Now()) {
+		return
+	}
+
+	ctx, span := tracing.StartSpan(context.Background(), "loyalty.checkOrders")
+	defer span.End()
+
+	start := time.Now()
+	tick := LoyaltyStatus{LastTickAt: start}
+	defer func() {
+		metrics.WorkerPollDuration.Observe(time.Since(start).Seconds())
+
+		updateLoyaltyStatus(func(status *LoyaltyStatus) {
+			tick.LastTickDuration = time.Since(start).String()
+			tick.BackoffUntil = status.BackoffUntil
+			tick.Listening = listening.Load()
+			*status = tick
+		})
+	}()
+
+	listCtx, cancel := context.WithTimeout(ctx, WorkerQueryTimeout)
+	defer cancel()
+
+	// Аренда в базе отсчитывается от момента захвата, то есть не раньше start, поэтому
+	// локальный срок leaseUntil истекает не позже неё
+	leaseUntil := start.Add(WorkerLeaseDuration)
+	orders, err := storage.ClaimDueOrders(listCtx, WorkerLeaseDuration, WorkerBatchSize)
+	if err != nil {
+		logger.Worker.Error("Error getting orders", zap.Error(err))
+		tick.LastError = err.Error()
+		return
+	}
+
+	if pending, err := storage.CountUnprocessedOrders(listCtx); err == nil {
+		metrics.WorkerPendingOrders.Set(float64(pending))
+	}
+	tick.QueueDepth = len(orders)
+
+	for i, order := range orders {
+		if shutdown.Err() != nil {
+			logger.Worker.Info("Stopping order processing on shutdown")
+			releaseOrders(ctx, orders[i:])
+			return
+		}
+		if time.Now().After(leaseUntil) {
+			// Оставшиеся заказы уже мог забрать другой экземпляр, поэтому они не освобождаются
+			logger.Worker.Warn("Order lease expired, stopping batch", zap.Int("remaining", len(orders)-i))
 			return
 		}
 
-		for _, order := range orders {
-			logger.Log.Info("Checking order:", zap.String("orderNumber", order.OrderNumber))
-			loyaltyResp, err := queryLoyaltySystem(order.OrderNumber)
-			if err != nil {
-				logger.Log.Error("Failed to query loyalty system for order", zap.String("orderNumber", order.OrderNumber), zap.Error(err))
-				continue
-			}
+		err = processOrder(ctx, order)
+
+		if errors.Is(err, accrual.ErrCircuitOpen) {
+			logger.Worker.Debug("Accrual circuit breaker is open, skipping remaining orders")
+			tick.LastError = err.Error()
+			releaseOrders(ctx, orders[i:])
+			return
+		}
 
-			updateOrderStatus(order.ID, loyaltyResp)
+		var rateLimitErr *accrual.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			until := time.Now().Add(rateLimitErr.RetryAfter)
+			updateLoyaltyStatus(func(status *LoyaltyStatus) {
+				status.BackoffUntil = &until
+			})
+			logger.Worker.Warn("Accrual system rate limit, pausing worker", zap.Time("until", until))
+			tick.LastError = err.Error()
+			releaseOrders(ctx, orders[i:])
+			return
 		}
 
+		// Следующая проверка откладывается и после ошибки: заказ, на котором система расчёта
+		// стабильно падает, не должен опрашиваться каждый тик
+		scheduleNextCheck(ctx, order)
+
+		if err != nil {
+			tick.Failed++
+			tick.LastError = err.Error()
+			continue
+		}
+		tick.Processed++
 	}
 }
 
-func queryLoyaltySystem(orderNumber string) (LoyaltyResponse, error) {
-	url := fmt.Sprintf("%s%s%s", config.AccrualSystemAddress, "/api/orders/", orderNumber)
-	logger.Log.Info("Querying loyalty system", zap.String("url", url))
-	resp, err := http.Get(url)
-	if err != nil {
-		return LoyaltyResponse{}, fmt.Errorf("HTTP request failed: %v", err)
+// releaseOrders снимает аренду с заказов, до которых воркер не дошёл
+func releaseOrders(ctx context.Context, orders []models.Order) {
+	ids := make([]int, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+
+	releaseCtx, cancel := context.WithTimeout(ctx, WorkerQueryTimeout)
+	defer cancel()
+
+	if err := storage.ReleaseOrders(releaseCtx, ids); err != nil {
+		logger.Worker.Error("Failed to release claimed orders", zap.Error(err))
+	}
+}
+
+func scheduleNextCheck(ctx context.Context, order models.Order) {
+	if err := storage.ScheduleOrderCheck(ctx, order.ID, orderBackoff(order.Attempts+1)); err != nil {
+		logger.Worker.Error("Failed to schedule order check", zap.String("orderNumber", order.OrderNumber), zap.Error(err))
 	}
-	defer resp.Body.Close()
+}
+
+// orderBackoff — пауза перед следующей проверкой заказа: OrderBaseBackoff, затем вдвое больше
+// с каждой попыткой, но не дольше OrderMaxBackoff
+func orderBackoff(attempts int) time.Duration {
+	backoff := OrderBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= OrderMaxBackoff {
+			return OrderMaxBackoff
+		}
+	}
+	return backoff
+}
 
-	body, _ := io.ReadAll(resp.Body)
+func processOrder(ctx context.Context, order models.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, WorkerOrderTimeout)
+	defer cancel()
 
-	var loyaltyResp LoyaltyResponse
-	err = json.Unmarshal(body, &loyaltyResp)
+	logger.Worker.Info("Checking order:", zap.String("orderNumber", order.OrderNumber))
+	status, err := accrual.Default.GetOrder(ctx, order.OrderNumber)
+	if errors.Is(err, accrual.ErrOrderNotRegistered) {
+		// Регистрация подтверждена, но система расчёта заказ ещё не видит — проверим позже
+		logger.Worker.Debug("Order is not known to accrual system yet", zap.String("orderNumber", order.OrderNumber))
+		return nil
+	}
 	if err != nil {
-		logger.Log.Error("Failed to decode response", zap.Error(err))
-		return LoyaltyResponse{}, fmt.Errorf("failed to decode response: %w", err)
+		logger.Worker.Error("Failed to query loyalty system for order", zap.String("orderNumber", order.OrderNumber), zap.Error(err))
+		return err
 	}
 
-	return loyaltyResp, nil
+	updateOrderStatus(ctx, order, status)
+	return nil
 }
 
-func updateOrderStatus(orderID int, loyaltyResp LoyaltyResponse) {
+func updateOrderStatus(ctx context.Context, order models.Order, status accrual.OrderStatus) {
 	var newStatus string
 
-	switch loyaltyResp.Status {
-	case "PROCESSED":
+	switch status.Status {
+	case accrual.StatusProcessed:
 		newStatus = models.PROCESSED
-	case "INVALID":
+	case accrual.StatusInvalid:
 		newStatus = models.INVALID
-	case "PROCESSING":
+	case accrual.StatusProcessing:
 		newStatus = models.PROCESSING
 	default:
 		newStatus = models.REGISTERED
 	}
 
-	accrual := loyaltyResp.Accrual
+	amount := status.Accrual
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
+	updated, err := storage.UpdateOrder(ctx, order.ID, newStatus, amount, order.UserID)
+	if err != nil {
+		logger.Worker.Error("Failed to update orders", zap.Error(err))
+		return
+	}
+	if !updated {
+		logger.Worker.Info("Order already finalized by another worker", zap.String("orderNumber", order.OrderNumber))
+		return
+	}
 
-	select {
-	case <-ctx.Done():
-		logger.Log.Info("Cancel updating orders")
-	default:
-		err := storage.UpdateOrder(ctx, orderID, newStatus, accrual, auth.UserID)
-		if err != nil {
-			logger.Log.Error("Failed to update orders", zap.Error(err))
-		}
+	logger.Worker.Info("Order updated", zap.String("orderID", strconv.Itoa(order.ID)))
+
+	if newStatus == order.Status && amount == order.Accrual {
+		return
+	}
+
+	if newStatus == models.PROCESSED {
+		metrics.OrderTimeToProcessed.Observe(time.Since(order.UploadedAt).Seconds())
+	}
+
+	publishOrderUpdate(ctx, order, newStatus, amount)
+}
+
+func publishOrderUpdate(ctx context.Context, order models.Order, newStatus string, amount float64) {
+	_, err := hub.Publish(ctx, order.UserID, hub.EventOrder, hub.OrderEvent{
+		Number:     order.OrderNumber,
+		Status:     newStatus,
+		Accrual:    amount,
+		UploadedAt: order.UploadedAt,
+	})
+	if err != nil {
+		logger.Worker.Error("Failed to publish order stream event", zap.Error(err))
+	}
 
-		logger.Log.Info("Order updated", zap.String("orderID", strconv.Itoa(orderID)))
+	if amount == order.Accrual {
+		return
+	}
+
+	balance, err := storage.GetUserBalance(ctx, order.UserID)
+	if err != nil {
+		logger.Worker.Error("Failed to get balance for stream event", zap.Error(err))
+		return
+	}
+
+	_, err = hub.Publish(ctx, order.UserID, hub.EventBalance, hub.BalanceEvent{
+		Current:   balance.CurrentBalance,
+		Withdrawn: balance.WithdrawnTotal,
+	})
+	if err != nil {
+		logger.Worker.Error("Failed to publish balance stream event", zap.Error(err))
 	}
 }
@@ -0,0 +1,174 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sol1corejz/goferrrmart/cmd/config"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDatabaseEnv — база для тестов воркеров; без неё тесты пропускаются. Таблицы создаются
+// через storage.Init, данные каждого теста привязаны к новому пользователю
+const testDatabaseEnv = "TEST_DATABASE_URI"
+
+func setupStorage(t *testing.T) {
+	t.Helper()
+
+	uri := os.Getenv(testDatabaseEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	if storage.DB == nil {
+		config.Current.DatabaseURI = uri
+		if err := storage.Init(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// setupFakeAccrual подменяет accrual.Default на Fake до конца теста
+func setupFakeAccrual(t *testing.T) *accrual.Fake {
+	t.Helper()
+
+	fake := accrual.NewFake()
+	defaultClient := accrual.Default
+	accrual.Default = fake
+	t.Cleanup(func() {
+		accrual.Default = defaultClient
+	})
+	return fake
+}
+
+func createTestUser(t *testing.T) uuid.UUID {
+	t.Helper()
+
+	userID := uuid.New()
+	if err := storage.CreateUser(context.Background(), userID.String(), "workers-"+userID.String(), "hash"); err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+// createRegisteredOrder создаёт заказ, уже зарегистрированный в системе расчёта
+func createRegisteredOrder(t *testing.T, userID uuid.UUID, number string) models.Order {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := storage.CreateOrder(ctx, userID.String(), number, nil); err != nil {
+		t.Fatal(err)
+	}
+	order, err := storage.GetOrderByNumber(ctx, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storage.MarkOrderRegistered(ctx, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// creditBalance начисляет amount на баланс пользователя через обработанный заказ
+func creditBalance(t *testing.T, userID uuid.UUID, amount float64) {
+	t.Helper()
+
+	order := createRegisteredOrder(t, userID, fmt.Sprintf("%d", time.Now().UnixNano()))
+	if _, err := storage.UpdateOrder(context.Background(), order.ID, models.PROCESSED, amount, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheckOrdersConcurrentWorkers запускает несколько воркеров на одной базе и проверяет,
+// что каждый заказ начислен ровно один раз
+func TestCheckOrdersConcurrentWorkers(t *testing.T) {
+	setupStorage(t)
+	fake := setupFakeAccrual(t)
+	ctx := context.Background()
+
+	const (
+		workers      = 4
+		ordersCount  = 40
+		orderAccrual = 10
+	)
+
+	userID := createTestUser(t)
+	prefix := time.Now().UnixNano()
+	for i := 0; i < ordersCount; i++ {
+		number := fmt.Sprintf("%d%03d", prefix, i)
+		createRegisteredOrder(t, userID, number)
+		fake.SetStatus(accrual.OrderStatus{Order: number, Status: accrual.StatusProcessed, Accrual: orderAccrual})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkOrdersForProcessing(ctx)
+		}()
+	}
+	wg.Wait()
+
+	orders, err := storage.GetUserOrders(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != ordersCount {
+		t.Fatalf("got %d orders, want %d", len(orders), ordersCount)
+	}
+	for _, order := range orders {
+		if order.Status != models.PROCESSED {
+			t.Fatalf("order %s status = %s, want %s", order.OrderNumber, order.Status, models.PROCESSED)
+		}
+	}
+
+	balance, err := storage.GetUserBalance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(ordersCount * orderAccrual); balance.CurrentBalance != want {
+		t.Fatalf("balance = %v, want %v", balance.CurrentBalance, want)
+	}
+}
+
+// TestProcessOrderAfterLeaseExpired — если аренда истекла и заказ обрабатывают сразу несколько
+// воркеров, начисление всё равно происходит один раз
+func TestProcessOrderAfterLeaseExpired(t *testing.T) {
+	setupStorage(t)
+	fake := setupFakeAccrual(t)
+	ctx := context.Background()
+
+	const orderAccrual = 25
+
+	userID := createTestUser(t)
+	number := fmt.Sprintf("%d", time.Now().UnixNano())
+	order := createRegisteredOrder(t, userID, number)
+	fake.SetStatus(accrual.OrderStatus{Order: number, Status: accrual.StatusProcessed, Accrual: orderAccrual})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := processOrder(ctx, order); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	balance, err := storage.GetUserBalance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.CurrentBalance != orderAccrual {
+		t.Fatalf("balance = %v, want %v", balance.CurrentBalance, orderAccrual)
+	}
+}
@@ -0,0 +1,230 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/metrics"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"time"
+)
+
+const (
+	RegistrationBatchSize   = 100
+	RegistrationBaseBackoff = 5 * time.Second
+	RegistrationMaxBackoff  = 10 * time.Minute
+)
+
+// startRegistrationDispatcher передаёт заказы из outbox в систему расчёта: сразу по уведомлению
+// о новом заказе, а неудачные попытки — по расписанию повторов
+func startRegistrationDispatcher(shutdown context.Context) {
+	defer wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-shutdown.Done():
+			logger.Worker.Info("Order registration dispatcher stopped")
+			return
+		case <-newRegistrations:
+		case <-timer.C:
+		}
+
+		dispatchRegistrations(shutdown)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(nextDelay(time.Now(), storage.NextRegistrationAttemptAt))
+	}
+}
+
+// dispatchRegistrations регистрирует пачку заказов, время попытки которых наступило.
+// Заказы, до которых очередь не дошла, возвращаются в очередь без увеличения числа попыток
+func dispatchRegistrations(shutdown context.Context) {
+	if backoffActive(time.Now()) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	leaseUntil := time.Now().Add(WorkerLeaseDuration)
+	registrations, err := storage.ClaimDueRegistrations(ctx, WorkerLeaseDuration, RegistrationBatchSize)
+	if err != nil {
+		logger.Worker.Error("Error getting order registrations", zap.Error(err))
+		return
+	}
+
+	if pending, err := storage.CountPendingRegistrations(ctx); err == nil {
+		metrics.AccrualPendingRegistrations.Set(float64(pending))
+	}
+
+	registered := 0
+	defer func() {
+		if registered > 0 {
+			wake(newOrders)
+		}
+	}()
+
+	for i, registration := range registrations {
+		if shutdown.Err() != nil {
+			postponeRegistrations(registrations[i:], 0)
+			return
+		}
+		if time.Now().After(leaseUntil) {
+			logger.Worker.Warn("Registration lease expired, stopping batch", zap.Int("remaining", len(registrations)-i))
+			return
+		}
+
+		err = registerOrder(context.Background(), registration)
+
+		if errors.Is(err, accrual.ErrCircuitOpen) {
+			logger.Worker.Debug("Accrual circuit breaker is open, postponing order registrations")
+			postponeRegistrations(registrations[i:], 0)
+			return
+		}
+
+		var rateLimitErr *accrual.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			until := time.Now().Add(rateLimitErr.RetryAfter)
+			updateLoyaltyStatus(func(status *LoyaltyStatus) {
+				status.BackoffUntil = &until
+			})
+			logger.Worker.Warn("Accrual system rate limit, pausing order registration", zap.Time("until", until))
+			postponeRegistrations(registrations[i:], rateLimitErr.RetryAfter)
+			return
+		}
+
+		if isRejected(err) {
+			rejectRegistration(registration, err)
+			continue
+		}
+		if err != nil {
+			failRegistration(registration, err)
+			continue
+		}
+
+		if err = storage.MarkOrderRegistered(context.Background(), registration.OrderID); err != nil {
+			// Регистрация повторится после аренды; повторная регистрация не считается ошибкой
+			logger.Worker.Error("Error marking order registered", zap.String("orderNumber", registration.OrderNumber), zap.Error(err))
+			continue
+		}
+		registered++
+	}
+}
+
+// registerOrder передаёт заказ с товарами в систему расчёта; повторная регистрация не считается ошибкой
+func registerOrder(ctx context.Context, registration models.AccrualRegistration) error {
+	ctx, cancel := context.WithTimeout(ctx, WorkerOrderTimeout)
+	defer cancel()
+
+	items, err := storage.GetOrderItems(ctx, registration.OrderID)
+	if err != nil {
+		return err
+	}
+
+	logger.Worker.Info("Registering order in accrual system", zap.String("orderNumber", registration.OrderNumber))
+	err = accrual.Default.RegisterOrder(ctx, accrual.Order{
+		Number: registration.OrderNumber,
+		Goods:  accrualGoods(items),
+	})
+	if errors.Is(err, accrual.ErrOrderAlreadyRegistered) {
+		return nil
+	}
+	return err
+}
+
+// accrualGoods переводит товары заказа в формат системы расчёта: у неё нет количества,
+// поэтому цена позиции передаётся как цена за единицу, умноженная на количество
+func accrualGoods(items []models.OrderItem) []accrual.Good {
+	goods := make([]accrual.Good, 0, len(items))
+	for _, item := range items {
+		goods = append(goods, accrual.Good{
+			Description: item.Description,
+			Price:       math.Round(item.Price*float64(item.Quantity)*100) / 100,
+		})
+	}
+	return goods
+}
+
+func failRegistration(registration models.AccrualRegistration, err error) {
+	attempts := registration.Attempts + 1
+	logger.Worker.Warn("Order registration failed",
+		zap.String("orderNumber", registration.OrderNumber),
+		zap.Int("attempts", attempts),
+		zap.Error(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	if err := storage.MarkRegistrationFailed(ctx, registration.OrderID, err.Error(), registrationBackoff(attempts)); err != nil {
+		logger.Worker.Error("Error marking order registration failed", zap.String("orderNumber", registration.OrderNumber), zap.Error(err))
+	}
+}
+
+// isRejected отделяет окончательный отказ системы расчёта в заказе (400, 422) от ошибок, которые
+// могут пройти при повторе. Прочие 4xx (401, 403, 404, 405, 413...) обычно означают ошибку
+// в адресе системы расчёта или прокси перед ней, и отклонять из-за них заказы нельзя
+func isRejected(err error) bool {
+	var statusErr *accrual.StatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.Code == http.StatusBadRequest || statusErr.Code == http.StatusUnprocessableEntity)
+}
+
+// rejectRegistration прекращает попытки регистрации и переводит заказ в INVALID
+func rejectRegistration(registration models.AccrualRegistration, err error) {
+	logger.Worker.Warn("Order registration rejected by accrual system",
+		zap.String("orderNumber", registration.OrderNumber),
+		zap.Error(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	order, updated, err := storage.RejectRegistration(ctx, registration.OrderID, err.Error())
+	if err != nil {
+		logger.Worker.Error("Error marking order registration rejected", zap.String("orderNumber", registration.OrderNumber), zap.Error(err))
+		return
+	}
+	if updated {
+		publishOrderUpdate(ctx, order, models.INVALID, order.Accrual)
+	}
+}
+
+func postponeRegistrations(registrations []models.AccrualRegistration, retryIn time.Duration) {
+	ids := make([]int, 0, len(registrations))
+	for _, registration := range registrations {
+		ids = append(ids, registration.OrderID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	if err := storage.PostponeRegistrations(ctx, ids, retryIn); err != nil {
+		logger.Worker.Error("Failed to postpone order registrations", zap.Error(err))
+	}
+}
+
+// registrationBackoff — пауза перед повторной регистрацией: RegistrationBaseBackoff, затем вдвое
+// больше с каждой попыткой, но не дольше RegistrationMaxBackoff. Попытки после сетевых ошибок
+// и 5xx не ограничены: заказ без регистрации никогда не получит начисление
+func registrationBackoff(attempts int) time.Duration {
+	backoff := RegistrationBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= RegistrationMaxBackoff {
+			return RegistrationMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,186 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/accrual"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIsRejected — окончательным отказом считаются только 400 и 422
+func TestIsRejected(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &accrual.StatusError{Code: http.StatusBadRequest}, want: true},
+		{err: &accrual.StatusError{Code: http.StatusUnprocessableEntity}, want: true},
+		{err: fmt.Errorf("register: %w", &accrual.StatusError{Code: http.StatusBadRequest}), want: true},
+		{err: fmt.Errorf("register: %w", &accrual.StatusError{Code: http.StatusNotFound})},
+		{err: &accrual.StatusError{Code: http.StatusUnauthorized}},
+		{err: &accrual.StatusError{Code: http.StatusForbidden}},
+		{err: &accrual.StatusError{Code: http.StatusMethodNotAllowed}},
+		{err: &accrual.StatusError{Code: http.StatusRequestEntityTooLarge}},
+		{err: &accrual.StatusError{Code: http.StatusRequestTimeout}},
+		{err: &accrual.StatusError{Code: http.StatusInternalServerError}},
+		{err: &accrual.StatusError{Code: http.StatusServiceUnavailable}},
+		{err: &accrual.RateLimitError{RetryAfter: time.Second}},
+		{err: accrual.ErrCircuitOpen},
+		{err: context.DeadlineExceeded},
+		{err: nil},
+	}
+
+	for _, tt := range tests {
+		if got := isRejected(tt.err); got != tt.want {
+			t.Errorf("isRejected(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestDispatchRegistrationsRejected — заказ, отклонённый системой расчёта с 4xx, становится INVALID,
+// а заказ, на котором она падает с 5xx, остаётся в очереди
+func TestDispatchRegistrationsRejected(t *testing.T) {
+	setupStorage(t)
+	fake := setupFakeAccrual(t)
+	ctx := context.Background()
+
+	userID := createTestUser(t)
+	prefix := time.Now().UnixNano()
+	rejected := fmt.Sprintf("%d1", prefix)
+	failing := fmt.Sprintf("%d2", prefix)
+	for _, number := range []string{rejected, failing} {
+		if err := storage.CreateOrder(ctx, userID.String(), number, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.SetError(rejected, &accrual.StatusError{Code: http.StatusBadRequest})
+	fake.SetError(failing, &accrual.StatusError{Code: http.StatusServiceUnavailable})
+
+	dispatchRegistrations(ctx)
+
+	order, err := storage.GetOrderByNumber(ctx, rejected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.INVALID {
+		t.Fatalf("rejected order status = %s, want %s", order.Status, models.INVALID)
+	}
+
+	order, err = storage.GetOrderByNumber(ctx, failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.NEW {
+		t.Fatalf("failing order status = %s, want %s", order.Status, models.NEW)
+	}
+}
+
+// TestWithdrawalIsNotSentToAccrual — номер списания занят в orders, но не регистрируется
+// в системе расчёта и не опрашивается воркером
+func TestWithdrawalIsNotSentToAccrual(t *testing.T) {
+	setupStorage(t)
+	fake := setupFakeAccrual(t)
+	ctx := context.Background()
+
+	userID := createTestUser(t)
+	creditBalance(t, userID, 20)
+	number := fmt.Sprintf("%d", time.Now().UnixNano())
+	if err := storage.CreateWithdrawal(ctx, userID, number, 10, models.AuditEntry{Action: models.AuditWithdrawal}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.CreateWithdrawal(ctx, userID, number, 10, models.AuditEntry{Action: models.AuditWithdrawal}); !errors.Is(err, storage.ErrOrderExists) {
+		t.Fatalf("second withdrawal err = %v, want ErrOrderExists", err)
+	}
+
+	dispatchRegistrations(ctx)
+	for _, order := range fake.Registered() {
+		if order.Number == number {
+			t.Fatalf("withdrawal %s was registered in accrual system", number)
+		}
+	}
+
+	order, err := storage.GetOrderByNumber(ctx, number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := storage.ClaimDueOrders(ctx, time.Minute, WorkerBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, claimedOrder := range claimed {
+		if claimedOrder.ID == order.ID {
+			t.Fatalf("withdrawal %s was claimed for polling", number)
+		}
+	}
+	releaseOrders(ctx, claimed)
+
+	orders, err := storage.GetUserOrders(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, total, err := storage.GetUserOrdersPage(ctx, userID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || len(page) != 1 || total != 1 {
+		t.Fatalf("order listings = %d, %d (total %d), want only the credited order", len(orders), len(page), total)
+	}
+	if orders[0].OrderNumber == number || page[0].OrderNumber == number {
+		t.Fatalf("withdrawal %s is listed among orders", number)
+	}
+}
+
+// TestCreateWithdrawalConcurrent — параллельные списания не уводят баланс в минус:
+// проходит ровно столько, сколько покрывает баланс
+func TestCreateWithdrawalConcurrent(t *testing.T) {
+	setupStorage(t)
+	ctx := context.Background()
+
+	const (
+		attempts = 8
+		sum      = 10
+	)
+
+	userID := createTestUser(t)
+	creditBalance(t, userID, 2*sum)
+	prefix := time.Now().UnixNano()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			err := storage.CreateWithdrawal(ctx, userID, fmt.Sprintf("%d%03d", prefix, i), sum, models.AuditEntry{Action: models.AuditWithdrawal})
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case !errors.Is(err, storage.ErrInsufficientFunds):
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 2 {
+		t.Fatalf("%d withdrawals succeeded, want 2", succeeded)
+	}
+
+	balance, err := storage.GetUserBalance(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.CurrentBalance != 0 || balance.WithdrawnTotal != 2*sum {
+		t.Fatalf("balance = %+v, want 0 current and %d withdrawn", balance, 2*sum)
+	}
+}
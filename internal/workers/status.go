@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"sync"
+	"time"
+)
+
+// LoyaltyStatus — внутреннее состояние воркера начислений для отладочных эндпоинтов
+type LoyaltyStatus struct {
+	LastTickAt       time.Time  `json:"last_tick_at"`
+	LastTickDuration string     `json:"last_tick_duration"`
+	QueueDepth       int        `json:"queue_depth"`
+	Processed        int        `json:"processed"`
+	Failed           int        `json:"failed"`
+	LastError        string     `json:"last_error,omitempty"`
+	BackoffUntil     *time.Time `json:"backoff_until,omitempty"`
+	// Listening — работает ли подписка на уведомления о новых заказах
+	Listening bool `json:"listening"`
+}
+
+var (
+	loyaltyStatusMu sync.Mutex
+	loyaltyStatus   LoyaltyStatus
+)
+
+// Status возвращает копию состояния воркера начислений
+func Status() LoyaltyStatus {
+	loyaltyStatusMu.Lock()
+	defer loyaltyStatusMu.Unlock()
+
+	status := loyaltyStatus
+	if status.BackoffUntil != nil {
+		until := *status.BackoffUntil
+		status.BackoffUntil = &until
+	}
+	return status
+}
+
+func updateLoyaltyStatus(update func(status *LoyaltyStatus)) {
+	loyaltyStatusMu.Lock()
+	defer loyaltyStatusMu.Unlock()
+
+	update(&loyaltyStatus)
+}
+
+// backoffActive сообщает, что система расчёта попросила подождать и опрос надо пропустить
+func backoffActive(now time.Time) bool {
+	loyaltyStatusMu.Lock()
+	defer loyaltyStatusMu.Unlock()
+
+	return loyaltyStatus.BackoffUntil != nil && now.Before(*loyaltyStatus.BackoffUntil)
+}
@@ -0,0 +1,99 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidWebhookURL     = errors.New("webhook url must be an absolute http or https url")
+	ErrForbiddenWebhookAddr  = errors.New("webhook url points to a loopback, private or link-local address")
+	ErrUnresolvedWebhookHost = errors.New("webhook host cannot be resolved")
+)
+
+// reservedPrefixes — диапазоны, которые не покрыты методами netip.Addr, но тоже не являются
+// публичными адресами в интернете
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// webhookClient подключается только к публичным адресам: проверка выполняется после
+// разрешения имени, поэтому её не обойти DNS-записью, сменившейся после регистрации, или редиректом
+var webhookClient = &http.Client{
+	Timeout: WebhookRequestTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: WebhookRequestTimeout,
+			Control: checkWebhookDial,
+		}).DialContext,
+		TLSHandshakeTimeout: WebhookRequestTimeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// ValidateWebhookURL проверяет адрес подписки: схема http(s) и хост, все адреса которого публичные
+func ValidateWebhookURL(ctx context.Context, raw string) (*url.URL, error) {
+	target, err := url.ParseRequestURI(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+
+	if addr, err := netip.ParseAddr(target.Hostname()); err == nil {
+		if !isPublicAddr(addr) {
+			return nil, ErrForbiddenWebhookAddr
+		}
+		return target, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return nil, ErrUnresolvedWebhookHost
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return nil, ErrForbiddenWebhookAddr
+		}
+	}
+
+	return target, nil
+}
+
+func checkWebhookDial(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook dial %s: %w", address, err)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook dial %s: %w", address, ErrForbiddenWebhookAddr)
+	}
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url string
+		err error
+	}{
+		{"https://93.184.215.14/hook", nil},
+		{"http://8.8.8.8:8080/hook", nil},
+		{"ftp://8.8.8.8/hook", ErrInvalidWebhookURL},
+		{"/hook", ErrInvalidWebhookURL},
+		{"http://127.0.0.1:8081/admin/audit", ErrForbiddenWebhookAddr},
+		{"http://localhost/hook", ErrForbiddenWebhookAddr},
+		{"http://169.254.169.254/latest/meta-data", ErrForbiddenWebhookAddr},
+		{"http://10.1.2.3/hook", ErrForbiddenWebhookAddr},
+		{"http://192.168.0.1/hook", ErrForbiddenWebhookAddr},
+		{"http://100.64.0.1/hook", ErrForbiddenWebhookAddr},
+		{"http://0.0.0.0/hook", ErrForbiddenWebhookAddr},
+		{"http://[::1]/hook", ErrForbiddenWebhookAddr},
+		{"http://[fe80::1]/hook", ErrForbiddenWebhookAddr},
+		{"http://[fd00::1]/hook", ErrForbiddenWebhookAddr},
+		{"http://[::ffff:127.0.0.1]/hook", ErrForbiddenWebhookAddr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := ValidateWebhookURL(context.Background(), tt.url)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ValidateWebhookURL(%q) = %v, want %v", tt.url, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := webhookClient.Get(server.URL)
+	if !errors.Is(err, ErrForbiddenWebhookAddr) {
+		t.Fatalf("webhookClient.Get(%s) error = %v, want %v", server.URL, err, ErrForbiddenWebhookAddr)
+	}
+}
@@ -0,0 +1,196 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/sol1corejz/goferrrmart/internal/logger"
+	"github.com/sol1corejz/goferrrmart/internal/models"
+	"github.com/sol1corejz/goferrrmart/internal/storage"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookInterval       = 2 * time.Second
+	WebhookBatchSize      = 100
+	WebhookMaxAttempts    = 8
+	WebhookBaseBackoff    = 10 * time.Second
+	WebhookMaxBackoff     = time.Hour
+	WebhookRequestTimeout = 10 * time.Second
+	// WebhookLeaseDuration — на сколько доставки закрепляются за экземпляром диспетчера
+	WebhookLeaseDuration = 2 * time.Minute
+	// WebhookRetention — сколько хранятся завершённые доставки и разосланные события outbox
+	WebhookRetention     = 7 * 24 * time.Hour
+	WebhookPruneInterval = time.Hour
+)
+
+const (
+	HeaderWebhookEvent     = "X-Gophermart-Event"
+	HeaderWebhookDelivery  = "X-Gophermart-Delivery"
+	HeaderWebhookSignature = "X-Gophermart-Signature"
+)
+
+func InitWebhookDispatcher(shutdown context.Context) {
+	wg.Add(1)
+	go startWebhookDispatcher(shutdown)
+
+	logger.Worker.Info("Webhook dispatcher started")
+}
+
+func startWebhookDispatcher(shutdown context.Context) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(WebhookInterval)
+	defer ticker.Stop()
+
+	var prunedAt time.Time
+	for {
+		select {
+		case <-shutdown.Done():
+			logger.Worker.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			dispatchWebhooks(shutdown)
+
+			if time.Since(prunedAt) >= WebhookPruneInterval {
+				pruneWebhookHistory()
+				prunedAt = time.Now()
+			}
+		}
+	}
+}
+
+// dispatchWebhooks рассылает пачку доставок. У каждой отправки и записи её результата свой таймаут:
+// медленные получатели не должны съедать время остальных и мешать записать попытку
+func dispatchWebhooks(shutdown context.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	if _, err := storage.FanOutOutboxEvents(ctx, WebhookBatchSize); err != nil {
+		logger.Worker.Error("Error fanning out outbox events", zap.Error(err))
+		return
+	}
+
+	leaseUntil := time.Now().Add(WebhookLeaseDuration)
+	deliveries, err := storage.ClaimDueWebhookDeliveries(ctx, WebhookLeaseDuration, WebhookBatchSize)
+	if err != nil {
+		logger.Worker.Error("Error getting webhook deliveries", zap.Error(err))
+		return
+	}
+
+	for i, delivery := range deliveries {
+		if shutdown.Err() != nil {
+			return
+		}
+		if time.Now().After(leaseUntil) {
+			logger.Worker.Warn("Webhook lease expired, stopping batch", zap.Int("remaining", len(deliveries)-i))
+			return
+		}
+		deliverWebhook(delivery)
+	}
+}
+
+func deliverWebhook(delivery models.WebhookDelivery) {
+	sendCtx, cancel := context.WithTimeout(context.Background(), WebhookRequestTimeout)
+	responseCode, err := sendWebhook(sendCtx, delivery)
+	cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	if err == nil {
+		if err = storage.MarkWebhookDelivered(ctx, delivery.ID, responseCode); err != nil {
+			logger.Worker.Error("Error marking webhook delivered", zap.Int("deliveryID", delivery.ID), zap.Error(err))
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	dead := attempts >= WebhookMaxAttempts
+
+	var code *int
+	if responseCode != 0 {
+		code = &responseCode
+	}
+
+	logger.Worker.Warn("Webhook delivery failed",
+		zap.Int("deliveryID", delivery.ID),
+		zap.Int("attempts", attempts),
+		zap.Bool("dead", dead),
+		zap.Error(err))
+
+	err = storage.MarkWebhookDeliveryFailed(ctx, delivery.ID, code, err.Error(), webhookBackoff(attempts), dead)
+	if err != nil {
+		logger.Worker.Error("Error marking webhook delivery failed", zap.Int("deliveryID", delivery.ID), zap.Error(err))
+	}
+}
+
+// pruneWebhookHistory удаляет доставленные и мёртвые доставки и разосланные события outbox
+// старше WebhookRetention
+func pruneWebhookHistory() {
+	ctx, cancel := context.WithTimeout(context.Background(), WorkerQueryTimeout)
+	defer cancel()
+
+	deliveries, events, err := storage.PruneWebhookHistory(ctx, WebhookRetention)
+	if err != nil {
+		logger.Worker.Error("Error pruning webhook history", zap.Error(err))
+		return
+	}
+	if deliveries > 0 || events > 0 {
+		logger.Worker.Info("Webhook history pruned", zap.Int64("deliveries", deliveries), zap.Int64("events", events))
+	}
+}
+
+func sendWebhook(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(fmt.Sprintf(`{"id":%d,"type":%q,"created_at":%q,"data":%s}`,
+		delivery.EventID, delivery.EventType, delivery.CreatedAt.UTC().Format(time.RFC3339), delivery.Payload))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(HeaderWebhookDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhook(delivery.Secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// SignWebhook считает HMAC-SHA256 тела запроса на секрете подписки
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	backoff := WebhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= WebhookMaxBackoff {
+			return WebhookMaxBackoff
+		}
+	}
+	return backoff
+}
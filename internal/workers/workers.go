@@ -0,0 +1,24 @@
+package workers
+
+import (
+	"context"
+	"sync"
+)
+
+var wg sync.WaitGroup
+
+// Wait ждёт завершения текущих итераций всех воркеров после отмены их контекста
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}